@@ -5,10 +5,23 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
+	ghnet "github.com/emetriq/gohelper/net"
 	"github.com/emetriq/gohelper/security/hash/sha256"
 )
 
+// HTTPClient is used by GetToken, replace it to use a proxy or other timeouts
+var HTTPClient = newHTTPClient()
+
+func newHTTPClient() *http.Client {
+	client, err := ghnet.NewHTTPClient(ghnet.Options{Timeout: 30 * time.Second})
+	if err != nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return client
+}
+
 type AuthenticationResult struct {
 	AccessToken  string `json:"AccessToken"`
 	IdToken      string `json:"IdToken"`
@@ -49,8 +62,7 @@ func GetToken(user, pw, cognitoAuthURL, cognitoClientID, cognitoClientSecret str
 	req, _ := http.NewRequest(http.MethodPost, cognitoAuthURL, responseBody)
 	req.Header.Add("X-Amz-Target", "AWSCognitoIdentityProviderService.InitiateAuth")
 	req.Header.Add("Content-Type", "application/x-amz-json-1.1")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
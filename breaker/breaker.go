@@ -0,0 +1,365 @@
+// Package breaker stops calls to a failing dependency for a while, so callers fail fast instead of piling up.
+//
+// A Breaker is closed and passes all calls until the failure rate within the window exceeds the limit. Then it
+// opens and rejects all calls with ErrOpen. After the open timeout it is half-open and lets a few probe calls
+// pass. If they succeed it closes, otherwise it opens again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+)
+
+// State of a circuit breaker
+type State int
+
+const (
+	// Closed passes all calls
+	Closed State = iota
+	// HalfOpen passes a limited number of probe calls
+	HalfOpen
+	// Open rejects all calls
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+var (
+	// ErrOpen is returned for calls which are rejected by an open breaker
+	ErrOpen = errors.New("circuit breaker is open")
+	// ErrTooManyProbes is returned for calls which are rejected by a half-open breaker because all probes are in flight
+	ErrTooManyProbes = errors.New("circuit breaker is half-open and all probes are in flight")
+)
+
+// windowBuckets is the number of buckets the failure rate window is divided into
+const windowBuckets = 10
+
+// minWindow is the shortest failure rate window, every bucket covers at least a millisecond
+const minWindow = windowBuckets * time.Millisecond
+
+// Option configures a Breaker
+type Option func(*config)
+
+type config struct {
+	window         time.Duration
+	failureRate    float64
+	minRequests    int
+	openTimeout    time.Duration
+	halfOpenProbes int
+	isFailure      func(err error) bool
+	metrics        *log.Metrics
+	onStateChange  []func(name string, from, to State)
+}
+
+// WithWindow sets the duration the failure rate is computed over (default 60s, at least 10ms)
+func WithWindow(d time.Duration) Option {
+	return func(cfg *config) {
+		if d > 0 {
+			cfg.window = d
+		}
+		if cfg.window < minWindow {
+			cfg.window = minWindow
+		}
+	}
+}
+
+// WithFailureRate opens the breaker when the share of failed calls in the window reaches rate (default 0.5)
+func WithFailureRate(rate float64) Option {
+	return func(cfg *config) {
+		if rate > 0 && rate <= 1 {
+			cfg.failureRate = rate
+		}
+	}
+}
+
+// WithMinRequests keeps the breaker closed until the window has at least n calls (default 20)
+func WithMinRequests(n int) Option {
+	return func(cfg *config) {
+		if n > 0 {
+			cfg.minRequests = n
+		}
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before it lets probes pass (default 30s)
+func WithOpenTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		if d > 0 {
+			cfg.openTimeout = d
+		}
+	}
+}
+
+// WithHalfOpenProbes sets how many probe calls a half-open breaker passes, it closes when all of them
+// succeeded (default 1)
+func WithHalfOpenProbes(n int) Option {
+	return func(cfg *config) {
+		if n > 0 {
+			cfg.halfOpenProbes = n
+		}
+	}
+}
+
+// WithFailureClassifier decides which errors count as failures (default all errors except context.Canceled,
+// a canceled call says nothing about the dependency). Errors which are not failures are ignored, they count
+// neither as success nor as failure.
+func WithFailureClassifier(isFailure func(err error) bool) Option {
+	return func(cfg *config) {
+		if isFailure != nil {
+			cfg.isFailure = isFailure
+		}
+	}
+}
+
+// WithMetrics records the metrics of the breaker in m (default log.DefaultMetrics)
+func WithMetrics(m *log.Metrics) Option {
+	return func(cfg *config) {
+		if m != nil {
+			cfg.metrics = m
+		}
+	}
+}
+
+// WithStateChange adds a func which is called on every state transition.
+// It is called while the breaker is locked and must not call the breaker.
+func WithStateChange(fn func(name string, from, to State)) Option {
+	return func(cfg *config) {
+		cfg.onStateChange = append(cfg.onStateChange, fn)
+	}
+}
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// bucket counts the calls of a part of the window
+type bucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// Breaker is a circuit breaker for a single dependency.
+// It records the metrics circuit_breaker.state (0 closed, 1 half-open, 2 open), circuit_breaker.transitions
+// and circuit_breaker.rejected tagged with name=<name> and logs every state transition.
+type Breaker struct {
+	name string
+	cfg  config
+	now  func() time.Time
+
+	mu             sync.Mutex
+	state          State
+	generation     uint64
+	openedAt       time.Time
+	buckets        [windowBuckets]bucket
+	probesInFlight int
+	probeSuccesses int
+}
+
+// New creates a closed breaker, the name identifies it in the metrics and logs
+func New(name string, opts ...Option) *Breaker {
+	cfg := config{
+		window:         time.Minute,
+		failureRate:    0.5,
+		minRequests:    20,
+		openTimeout:    30 * time.Second,
+		halfOpenProbes: 1,
+		isFailure:      defaultIsFailure,
+		metrics:        log.DefaultMetrics,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	b := &Breaker{name: name, cfg: cfg, now: time.Now}
+	b.cfg.metrics.GetTaggedGauge("circuit_breaker.state", b.tags()).Update(int64(Closed))
+	return b
+}
+
+// Name returns the name of the breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state, an open breaker whose timeout passed is half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenTimeout(b.now())
+	return b.state
+}
+
+// Allow reserves a call. It returns ErrOpen or ErrTooManyProbes if the call is rejected, otherwise the caller must
+// pass the result of the call to done.
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.checkOpenTimeout(now)
+	switch b.state {
+	case Open:
+		b.cfg.metrics.GetTaggedCounter("circuit_breaker.rejected", b.tags()).Inc(1)
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probesInFlight+b.probeSuccesses >= b.cfg.halfOpenProbes {
+			b.cfg.metrics.GetTaggedCounter("circuit_breaker.rejected", b.tags()).Inc(1)
+			return nil, ErrTooManyProbes
+		}
+		b.probesInFlight++
+	}
+	generation := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.done(generation, err) })
+	}, nil
+}
+
+// Execute calls fn if the breaker allows it and records its result
+func (b *Breaker) Execute(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			done(fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	err = fn()
+	done(err)
+	return err
+}
+
+// Call calls fn through the breaker and returns its result. If the breaker rejects the call or fn fails and
+// fallback is not nil, the result of fallback with the error is returned instead.
+func Call[T any](b *Breaker, fn func() (T, error), fallback func(err error) (T, error)) (T, error) {
+	var value T
+	err := b.Execute(func() error {
+		var err error
+		value, err = fn()
+		return err
+	})
+	if err != nil && fallback != nil {
+		return fallback(err)
+	}
+	return value, err
+}
+
+// done records the result of a call which was allowed in the given generation
+func (b *Breaker) done(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		// the state changed since the call was allowed
+		return
+	}
+	now := b.now()
+	failed := b.cfg.isFailure(err)
+	ignored := err != nil && !failed
+	switch b.state {
+	case Closed:
+		if ignored {
+			return
+		}
+		bucket := b.bucket(now)
+		if failed {
+			bucket.failures++
+		} else {
+			bucket.successes++
+		}
+		if failed && b.tripped(now) {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		// an ignored probe only releases its slot
+		b.probesInFlight--
+		if ignored {
+			return
+		}
+		if failed {
+			b.setState(Open, now)
+			return
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.cfg.halfOpenProbes {
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// checkOpenTimeout moves an open breaker to half-open when its timeout passed, b.mu must be held
+func (b *Breaker) checkOpenTimeout(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.cfg.openTimeout {
+		b.setState(HalfOpen, now)
+	}
+}
+
+// bucket returns the bucket of now and resets buckets which fell out of the window, b.mu must be held
+func (b *Breaker) bucket(now time.Time) *bucket {
+	size := b.cfg.window / windowBuckets
+	start := now.Truncate(size)
+	current := &b.buckets[(start.UnixNano()/int64(size))%windowBuckets]
+	if !current.start.Equal(start) {
+		*current = bucket{start: start}
+	}
+	return current
+}
+
+// tripped reports whether the failure rate of the window reached the limit, b.mu must be held
+func (b *Breaker) tripped(now time.Time) bool {
+	successes, failures := 0, 0
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.cfg.window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	total := successes + failures
+	return total >= b.cfg.minRequests && float64(failures) >= b.cfg.failureRate*float64(total)
+}
+
+// setState moves the breaker to a new state and resets the counts, b.mu must be held
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probesInFlight, b.probeSuccesses = 0, 0
+	if state == Open {
+		b.openedAt = now
+	}
+	if state == Closed {
+		b.buckets = [windowBuckets]bucket{}
+	}
+
+	tags := b.tags()
+	b.cfg.metrics.GetTaggedGauge("circuit_breaker.state", tags).Update(int64(state))
+	tags["to"] = state.String()
+	b.cfg.metrics.GetTaggedCounter("circuit_breaker.transitions", tags).Inc(1)
+	if state == Open {
+		log.Logger.Warnf("circuit breaker %s changed from %s to %s", b.name, from, state)
+	} else {
+		log.Logger.Infof("circuit breaker %s changed from %s to %s", b.name, from, state)
+	}
+	for _, fn := range b.cfg.onStateChange {
+		fn(b.name, from, state)
+	}
+}
+
+func (b *Breaker) tags() map[string]string {
+	return map[string]string{"name": b.name}
+}
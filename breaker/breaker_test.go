@@ -0,0 +1,157 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var errDependency = errors.New("dependency failed")
+
+// newTestBreaker creates a breaker with a controllable clock
+func newTestBreaker(opts ...Option) (*Breaker, *time.Time, *log.Metrics) {
+	m := log.NewMetrics(nil)
+	b := New("test", append([]Option{WithMetrics(m)}, opts...)...)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, &now, m
+}
+
+func fail() error { return errDependency }
+
+func succeed() error { return nil }
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	transitions := []State{}
+	b, now, m := newTestBreaker(WithMinRequests(4), WithFailureRate(0.5), WithOpenTimeout(10*time.Second),
+		WithStateChange(func(name string, from, to State) { transitions = append(transitions, to) }))
+
+	assert.Nil(t, b.Execute(succeed))
+	assert.Nil(t, b.Execute(succeed))
+	assert.Equal(t, errDependency, b.Execute(fail))
+	assert.Equal(t, Closed, b.State(), "below the min requests")
+	assert.Equal(t, errDependency, b.Execute(fail))
+	assert.Equal(t, Open, b.State())
+
+	calls := 0
+	err := b.Execute(func() error { calls++; return nil })
+	assert.Equal(t, ErrOpen, err)
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, int64(Open), m.Registry().Get("circuit_breaker.state;name=test").(metrics.Gauge).Value())
+	assert.Equal(t, int64(1), m.Registry().Get("circuit_breaker.rejected;name=test").(metrics.Counter).Count())
+
+	// a single probe passes after the open timeout
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, HalfOpen, b.State())
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrTooManyProbes, err)
+	done(errDependency)
+	assert.Equal(t, Open, b.State())
+
+	*now = now.Add(10 * time.Second)
+	assert.Nil(t, b.Execute(succeed))
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, []State{Open, HalfOpen, Open, HalfOpen, Closed}, transitions)
+	assert.Equal(t, int64(2), m.Registry().Get("circuit_breaker.transitions;name=test;to=open").(metrics.Counter).Count())
+	assert.Equal(t, int64(1), m.Registry().Get("circuit_breaker.transitions;name=test;to=closed").(metrics.Counter).Count())
+
+	// the window was reset when the breaker closed
+	assert.Equal(t, errDependency, b.Execute(fail))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b, now, _ := newTestBreaker(WithMinRequests(2), WithFailureRate(1), WithWindow(10*time.Second))
+	assert.NotNil(t, b.Execute(fail))
+	*now = now.Add(11 * time.Second)
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Closed, b.State(), "the first failure fell out of the window")
+	*now = now.Add(5 * time.Second)
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerIgnoresStaleResults(t *testing.T) {
+	b, _, _ := newTestBreaker(WithMinRequests(1))
+	done, err := b.Allow()
+	assert.Nil(t, err)
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Open, b.State())
+	done(nil)
+	done(nil)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerFailureClassifier(t *testing.T) {
+	b, _, _ := newTestBreaker(WithMinRequests(1))
+	assert.Equal(t, context.Canceled, b.Execute(func() error { return context.Canceled }))
+	assert.Equal(t, Closed, b.State())
+
+	b, _, _ = newTestBreaker(WithMinRequests(1), WithFailureClassifier(func(err error) bool { return false }))
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerIgnoresCanceledCalls(t *testing.T) {
+	canceled := func() error { return context.Canceled }
+	b, now, _ := newTestBreaker(WithMinRequests(2), WithFailureRate(0.5), WithOpenTimeout(time.Second))
+	assert.NotNil(t, b.Execute(canceled))
+	assert.NotNil(t, b.Execute(canceled))
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Closed, b.State(), "canceled calls are not counted")
+	assert.NotNil(t, b.Execute(fail))
+	assert.Equal(t, Open, b.State())
+
+	// a canceled probe only releases its slot
+	*now = now.Add(time.Second)
+	assert.NotNil(t, b.Execute(canceled))
+	assert.Equal(t, HalfOpen, b.State())
+	assert.Nil(t, b.Execute(succeed))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreakerMinWindow(t *testing.T) {
+	b, _, _ := newTestBreaker(WithMinRequests(1), WithWindow(time.Nanosecond))
+	assert.NotPanics(t, func() { b.Execute(fail) })
+	assert.Equal(t, Open, b.State())
+}
+
+func TestCall(t *testing.T) {
+	b, _, _ := newTestBreaker(WithMinRequests(1))
+	value, err := Call(b, func() (string, error) { return "fresh", nil }, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", value)
+
+	fallback := func(err error) (string, error) { return "cached", nil }
+	value, err = Call(b, func() (string, error) { return "", errDependency }, fallback)
+	assert.Nil(t, err)
+	assert.Equal(t, "cached", value)
+	assert.Equal(t, Open, b.State())
+
+	var fallbackErr error
+	value, err = Call(b, func() (string, error) { return "fresh", nil }, func(err error) (string, error) {
+		fallbackErr = err
+		return "cached", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "cached", value)
+	assert.Equal(t, ErrOpen, fallbackErr)
+
+	_, err = Call(b, func() (string, error) { return "fresh", nil }, nil)
+	assert.Equal(t, ErrOpen, err)
+}
+
+func TestExecutePanic(t *testing.T) {
+	b, _, _ := newTestBreaker(WithMinRequests(1))
+	assert.Panics(t, func() {
+		b.Execute(func() error { panic("boom") })
+	})
+	assert.Equal(t, Open, b.State())
+}
@@ -0,0 +1,43 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// roundTripper passes requests through a breaker
+type roundTripper struct {
+	breaker *Breaker
+	next    http.RoundTripper
+}
+
+// RoundTripper wraps next, so all requests pass the breaker. Transport errors and responses with the status 429 or
+// a 5xx status count as failures, the responses are returned unchanged. Rejected requests fail with an error which
+// wraps ErrOpen or ErrTooManyProbes. If next is nil http.DefaultTransport is used.
+func (b *Breaker) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{breaker: b, next: next}
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, err := t.breaker.Allow()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		done(fmt.Errorf("%s %s: status %s", req.Method, req.URL.Redacted(), resp.Status))
+	} else {
+		done(nil)
+	}
+	return resp, nil
+}
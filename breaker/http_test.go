@@ -0,0 +1,45 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTripper(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	b, _, _ := newTestBreaker(WithMinRequests(2))
+	client := &http.Client{Transport: b.RoundTripper(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if assert.Nil(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+	}
+	assert.Equal(t, Open, b.State())
+
+	status = http.StatusOK
+	_, err := client.Get(server.URL)
+	assert.True(t, errors.Is(err, ErrOpen))
+
+	b, _, _ = newTestBreaker(WithMinRequests(1))
+	client = &http.Client{Transport: b.RoundTripper(nil)}
+	resp, err := client.Get(server.URL)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, Closed, b.State())
+	server.Close()
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err)
+	assert.Equal(t, Open, b.State())
+}
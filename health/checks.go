@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/emetriq/gohelper/aws/s3helper"
+	ghnet "github.com/emetriq/gohelper/net"
+)
+
+// TCPCheck checks that a TCP connection to the address can be established
+func TCPCheck(addr string) CheckFunc {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// GraphiteCheck checks that the graphite host (host:port) accepts TCP connections
+func GraphiteCheck(graphiteHost string) CheckFunc {
+	return TCPCheck(graphiteHost)
+}
+
+// GraylogCheck checks that the graylog server accepts TCP connections at tcpAddr (host:port), which must be a
+// TCP endpoint of graylog like its GELF TCP input or its API port. It can not check the GELF UDP input used by
+// InitGraylog: UDP is connectionless, so the UDP address of InitGraylog always fails the check. Register it
+// with NonCritical if the service works without graylog.
+func GraylogCheck(tcpAddr string) CheckFunc {
+	return func(ctx context.Context) error {
+		if tcpAddr == "" {
+			return fmt.Errorf("graylog address not configured")
+		}
+		return TCPCheck(tcpAddr)(ctx)
+	}
+}
+
+// ProxyCheck checks that testURL can be fetched through the SOCKS5 or HTTP proxy with net.CheckProxyContext
+func ProxyCheck(proxyURL string, testURL string, opts ...ghnet.ProxyCheckOption) CheckFunc {
+	return func(ctx context.Context) error {
+		_, err := ghnet.CheckProxyContext(ctx, proxyURL, testURL, opts...)
+		return err
+	}
+}
+
+// S3BucketCheck checks that the bucket exists and the client has access to it
+func S3BucketCheck(client *s3helper.Client, bucket string) CheckFunc {
+	return func(ctx context.Context) error {
+		_, err := client.Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		return err
+	}
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/emetriq/gohelper/aws/s3helper"
+	"github.com/emetriq/gohelper/log"
+	ghnet "github.com/emetriq/gohelper/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	assert.Nil(t, GraphiteCheck(addr)(context.Background()))
+	listener.Close()
+	assert.NotNil(t, GraphiteCheck(addr)(context.Background()))
+}
+
+func TestGraylogCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	assert.Nil(t, GraylogCheck(addr)(context.Background()))
+	listener.Close()
+	assert.NotNil(t, GraylogCheck(addr)(context.Background()), "a stopped server fails the check")
+	assert.NotNil(t, GraylogCheck("")(context.Background()))
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer udp.Close()
+	assert.NotNil(t, GraylogCheck(udp.LocalAddr().String())(context.Background()),
+		"a GELF UDP input can not be checked and is reported as down")
+}
+
+func TestProxyCheck(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	server, addr, err := ghnet.StartSocks5Server("127.0.0.1:0", ghnet.WithSocks5Credentials("user", "secret"),
+		ghnet.WithSocks5Metrics(log.NewMetrics(nil)))
+	assert.Nil(t, err)
+	defer server.Close()
+
+	assert.Nil(t, ProxyCheck("socks5h://user:secret@"+addr, target.URL)(context.Background()))
+	assert.NotNil(t, ProxyCheck("socks5h://user:wrong@"+addr, target.URL)(context.Background()))
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	assert.Nil(t, DiskSpaceCheck(t.TempDir(), 1)(context.Background()))
+	assert.NotNil(t, DiskSpaceCheck(t.TempDir(), 1<<62)(context.Background()))
+}
+
+func TestS3BucketCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/existing" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	assert.Nil(t, err)
+	client := s3helper.NewS3ClientWithSession(sess)
+
+	assert.Nil(t, S3BucketCheck(client, "existing")(context.Background()))
+	assert.NotNil(t, S3BucketCheck(client, "missing")(context.Background()))
+}
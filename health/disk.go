@@ -0,0 +1,24 @@
+//go:build linux || darwin
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+)
+
+// DiskSpaceCheck checks that the file system of path has at least minFreeBytes available for unprivileged users
+func DiskSpaceCheck(path string, minFreeBytes uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err != nil {
+			return err
+		}
+		free := uint64(stat.Bavail) * uint64(stat.Bsize)
+		if free < minFreeBytes {
+			return fmt.Errorf("only %d bytes free on %s, expected at least %d", free, path, minFreeBytes)
+		}
+		return nil
+	}
+}
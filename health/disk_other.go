@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package health
+
+import (
+	"context"
+	"errors"
+)
+
+// DiskSpaceCheck is not supported on this platform, the check always fails
+func DiskSpaceCheck(path string, minFreeBytes uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		return errors.New("disk space check not supported on this platform")
+	}
+}
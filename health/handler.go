@@ -0,0 +1,58 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/emetriq/gohelper/log"
+)
+
+// LivenessHandler responds with the JSON report of the liveness checks of the default registry, see Registry.LivenessHandler
+func LivenessHandler() http.Handler {
+	return DefaultRegistry.LivenessHandler()
+}
+
+// ReadinessHandler responds with the JSON report of all checks of the default registry, see Registry.ReadinessHandler
+func ReadinessHandler() http.Handler {
+	return DefaultRegistry.ReadinessHandler()
+}
+
+// Mount registers the liveness handler at /healthz and the readiness handler at /readyz of the default registry
+func Mount(mux *http.ServeMux) {
+	DefaultRegistry.Mount(mux)
+}
+
+// LivenessHandler responds with the JSON report of the checks registered with Liveness,
+// the status code is 503 if one of them failed and 200 otherwise
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Live(req.Context()))
+	})
+}
+
+// ReadinessHandler responds with the JSON report of all checks,
+// the status code is 503 if a critical check failed and 200 otherwise
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Ready(req.Context()))
+	})
+}
+
+// Mount registers the liveness handler at /healthz and the readiness handler at /readyz
+func (r *Registry) Mount(mux *http.ServeMux) {
+	mux.Handle("/healthz", r.LivenessHandler())
+	mux.Handle("/readyz", r.ReadinessHandler())
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Logger.Warnf("failed to write health report: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+)
+
+// CheckFunc checks a dependency and returns an error if it is not usable
+type CheckFunc func(ctx context.Context) error
+
+// Status is the state of a check or of all checks
+type Status string
+
+const (
+	// StatusUp means all checks passed
+	StatusUp Status = "up"
+	// StatusDegraded means only non critical checks failed
+	StatusDegraded Status = "degraded"
+	// StatusDown means a critical check failed
+	StatusDown Status = "down"
+)
+
+// ErrCheckTimeout is returned for a check which did not finish within its timeout
+var ErrCheckTimeout = errors.New("health check timed out")
+
+// CheckOption configures a registered check
+type CheckOption func(*check)
+
+// WithTimeout sets the maximum duration of a check (default 5s)
+func WithTimeout(d time.Duration) CheckOption {
+	return func(c *check) {
+		if d > 0 {
+			c.timeout = d
+		}
+	}
+}
+
+// NonCritical marks a check whose failure degrades the service but does not make it unready
+func NonCritical() CheckOption {
+	return func(c *check) {
+		c.critical = false
+	}
+}
+
+// Liveness runs the check for the liveness probe as well, use it only for checks of the process itself
+// because a failing liveness probe restarts the service
+func Liveness() CheckOption {
+	return func(c *check) {
+		c.liveness = true
+	}
+}
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	timeout  time.Duration
+	critical bool
+	liveness bool
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Critical bool          `json:"critical"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Report is the outcome of all checks of a probe
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Registry holds the named checks of the components of a service
+type Registry struct {
+	mu      sync.RWMutex
+	checks  map[string]*check
+	metrics *log.Metrics
+}
+
+// DefaultRegistry is the registry used by the package level functions
+var DefaultRegistry = NewRegistry(nil)
+
+// NewRegistry creates an empty registry which records the check results in m, if m is nil log.DefaultMetrics is used.
+// Every check updates the gauge health.check.up (1 or 0) and the timer health.check.duration tagged with the check name.
+func NewRegistry(m *log.Metrics) *Registry {
+	if m == nil {
+		m = log.DefaultMetrics
+	}
+	return &Registry{checks: map[string]*check{}, metrics: m}
+}
+
+// Register adds a critical readiness check with a timeout of 5 seconds to the default registry
+func Register(name string, fn CheckFunc, opts ...CheckOption) {
+	DefaultRegistry.Register(name, fn, opts...)
+}
+
+// Register adds a critical readiness check with a timeout of 5 seconds, a check with the same name is replaced
+func (r *Registry) Register(name string, fn CheckFunc, opts ...CheckOption) {
+	c := &check{name: name, fn: fn, timeout: 5 * time.Second, critical: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = c
+}
+
+// Unregister removes the check with the given name
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Ready runs all checks concurrently and reports StatusDown if a critical check failed
+func (r *Registry) Ready(ctx context.Context) Report {
+	return r.run(ctx, false)
+}
+
+// Live runs the checks registered with Liveness concurrently
+func (r *Registry) Live(ctx context.Context) Report {
+	return r.run(ctx, true)
+}
+
+func (r *Registry) run(ctx context.Context, livenessOnly bool) Report {
+	r.mu.RLock()
+	checks := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		if c.liveness || !livenessOnly {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for idx, c := range checks {
+		wg.Add(1)
+		go func(idx int, c *check) {
+			defer wg.Done()
+			results[idx] = r.runCheck(ctx, c)
+		}(idx, c)
+	}
+	wg.Wait()
+	sort.Slice(results, func(a, b int) bool { return results[a].Name < results[b].Name })
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// runCheck runs a single check with its timeout, checks which ignore the context are abandoned after the timeout
+func (r *Registry) runCheck(ctx context.Context, c *check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errCh <- fmt.Errorf("health check panicked: %v", p)
+			}
+		}()
+		errCh <- c.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ErrCheckTimeout
+	}
+
+	result := Result{Name: c.name, Status: StatusUp, Critical: c.critical, Duration: time.Since(start)}
+	tags := map[string]string{"check": c.name}
+	up := int64(1)
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+		up = 0
+		log.Logger.Warnf("health check %s failed: %v", c.name, err)
+	}
+	r.metrics.GetTaggedGauge("health.check.up", tags).Update(up)
+	r.metrics.GetTaggedTimer("health.check.duration", tags).Update(result.Duration)
+	return result
+}
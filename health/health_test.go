@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryReady(t *testing.T) {
+	m := log.NewMetrics(nil)
+	r := NewRegistry(m)
+	r.Register("db", func(ctx context.Context) error { return nil })
+	assert.Equal(t, StatusUp, r.Ready(context.Background()).Status)
+
+	r.Register("cache", func(ctx context.Context) error { return errors.New("unreachable") }, NonCritical())
+	report := r.Ready(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, Result{Name: "cache", Status: StatusDown, Error: "unreachable", Duration: report.Checks[0].Duration}, report.Checks[0])
+	assert.Equal(t, int64(0), m.Registry().Get("health.check.up;check=cache").(metrics.Gauge).Value())
+	assert.Equal(t, int64(1), m.Registry().Get("health.check.up;check=db").(metrics.Gauge).Value())
+
+	r.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}, WithTimeout(10*time.Millisecond))
+	report = r.Ready(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, ErrCheckTimeout.Error(), report.Checks[2].Error)
+
+	r.Unregister("slow")
+	assert.Len(t, r.Ready(context.Background()).Checks, 2)
+}
+
+func TestRegistryPanickingCheck(t *testing.T) {
+	r := NewRegistry(log.NewMetrics(nil))
+	r.Register("broken", func(ctx context.Context) error { panic("boom") })
+	report := r.Ready(context.Background())
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "health check panicked: boom", report.Checks[0].Error)
+}
+
+func TestHandlers(t *testing.T) {
+	r := NewRegistry(log.NewMetrics(nil))
+	r.Register("dependency", func(ctx context.Context) error { return errors.New("down") })
+	r.Register("process", func(ctx context.Context) error { return nil }, Liveness())
+	mux := http.NewServeMux()
+	r.Mount(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report Report
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Checks, 1)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, "down", report.Checks[0].Error)
+}
@@ -0,0 +1,238 @@
+package log
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// AlertKind defines how an alert rule evaluates its metric
+type AlertKind int
+
+const (
+	// AlertThreshold fires when the value crosses the limit
+	AlertThreshold AlertKind = iota
+	// AlertRateOfChange fires when the change of the value per second crosses the limit
+	AlertRateOfChange
+	// AlertAbsence fires when the metric is missing or its value did not change for the For duration
+	AlertAbsence
+)
+
+// AlertRule is a condition on a single value of a metric.
+// Threshold and rate of change rules fire when the condition held for the For duration and resolve when the value
+// is back on the other side of the limit by more than the Hysteresis, so a flapping value does not fire repeatedly.
+type AlertRule struct {
+	Name string
+	// Metric is the name of the metric in the registry, see TaggedName for tagged metrics
+	Metric string
+	// Field is the value of the metric, e.g. "one-minute" of a meter or "99-percentile" of a timer.
+	// Timer durations are in milliseconds. The default is "value" for gauges and "count" for all other metrics.
+	Field string
+	Kind  AlertKind
+	// Below fires when the value is lower than the limit instead of higher
+	Below      bool
+	Limit      float64
+	Hysteresis float64
+	For        time.Duration
+}
+
+// AlertEvent is passed to the alert handlers when a rule fires or resolves.
+// The Field of the Rule is set to the evaluated field. The Value of absence rules is the idle time in seconds.
+type AlertEvent struct {
+	Rule   AlertRule
+	Value  float64
+	Firing bool
+	Time   time.Time
+}
+
+// AlertHandler is called when a rule fires or resolves
+type AlertHandler func(event AlertEvent)
+
+// LogAlert logs firing rules as warnings and resolved rules as infos through Logger
+func LogAlert(event AlertEvent) {
+	if event.Firing {
+		Logger.Warnf("alert %s firing: %s %s is %s", event.Rule.Name, event.Rule.Metric, event.Rule.Field, formatMetricValue(event.Value))
+	} else {
+		Logger.Infof("alert %s resolved: %s %s is %s", event.Rule.Name, event.Rule.Metric, event.Rule.Field, formatMetricValue(event.Value))
+	}
+}
+
+// AlertOption configures an AlertEvaluator
+type AlertOption func(*AlertEvaluator)
+
+// WithAlertRegistry sets the registry the rules are evaluated on (default metrics.DefaultRegistry)
+func WithAlertRegistry(r metrics.Registry) AlertOption {
+	return func(e *AlertEvaluator) {
+		if r != nil {
+			e.registry = r
+		}
+	}
+}
+
+// WithAlertHandler adds a handler which is called when a rule fires or resolves.
+// LogAlert is used if no handler is set.
+func WithAlertHandler(handler AlertHandler) AlertOption {
+	return func(e *AlertEvaluator) {
+		e.handlers = append(e.handlers, handler)
+	}
+}
+
+// alertState is the evaluation state of a single rule
+type alertState struct {
+	firing       bool
+	pendingSince time.Time
+	hasLast      bool
+	lastValue    float64
+	lastTime     time.Time
+	lastChange   time.Time
+}
+
+// defaultAlertInterval is the evaluation interval of Start without a valid interval
+const defaultAlertInterval = 10 * time.Second
+
+// AlertEvaluator evaluates alert rules on the metrics of a registry
+type AlertEvaluator struct {
+	registry metrics.Registry
+	rules    []AlertRule
+	handlers []AlertHandler
+	now      func() time.Time
+
+	mu     sync.Mutex
+	states []alertState
+}
+
+// NewAlertEvaluator creates an evaluator for the given rules
+func NewAlertEvaluator(rules []AlertRule, opts ...AlertOption) *AlertEvaluator {
+	e := &AlertEvaluator{
+		registry: metrics.DefaultRegistry,
+		rules:    rules,
+		now:      time.Now,
+		states:   make([]alertState, len(rules)),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if len(e.handlers) == 0 {
+		e.handlers = []AlertHandler{LogAlert}
+	}
+	return e
+}
+
+// Start evaluates the rules every interval (10s if interval <= 0) until the returned func is called
+func (e *AlertEvaluator) Start(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultAlertInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go runEvery(ctx, interval, e.Evaluate)
+	return cancel
+}
+
+// Evaluate evaluates all rules once and calls the handlers for every rule which fired or resolved
+func (e *AlertEvaluator) Evaluate() {
+	e.mu.Lock()
+	now := e.now()
+	events := []AlertEvent{}
+	for idx, rule := range e.rules {
+		if event, ok := e.evaluate(rule, &e.states[idx], now); ok {
+			events = append(events, event)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, event := range events {
+		for _, handler := range e.handlers {
+			handler(event)
+		}
+	}
+}
+
+// evaluate updates the state of the rule and returns an event if the rule fired or resolved
+func (e *AlertEvaluator) evaluate(rule AlertRule, state *alertState, now time.Time) (AlertEvent, bool) {
+	value, found := e.value(&rule)
+	if rule.Kind == AlertAbsence {
+		return evaluateAbsence(rule, state, value, found, now)
+	}
+	if !found {
+		return AlertEvent{}, false
+	}
+	if rule.Kind == AlertRateOfChange {
+		last, lastTime, hasLast := state.lastValue, state.lastTime, state.hasLast
+		state.lastValue, state.lastTime, state.hasLast = value, now, true
+		seconds := now.Sub(lastTime).Seconds()
+		if !hasLast || seconds <= 0 {
+			return AlertEvent{}, false
+		}
+		value = (value - last) / seconds
+	}
+
+	breached := rule.Below && value < rule.Limit || !rule.Below && value > rule.Limit
+	cleared := rule.Below && value > rule.Limit+rule.Hysteresis || !rule.Below && value < rule.Limit-rule.Hysteresis
+	if !breached {
+		state.pendingSince = time.Time{}
+		if state.firing && cleared {
+			state.firing = false
+			return AlertEvent{Rule: rule, Value: value, Firing: false, Time: now}, true
+		}
+		return AlertEvent{}, false
+	}
+	if state.pendingSince.IsZero() {
+		state.pendingSince = now
+	}
+	if !state.firing && now.Sub(state.pendingSince) >= rule.For {
+		state.firing = true
+		return AlertEvent{Rule: rule, Value: value, Firing: true, Time: now}, true
+	}
+	return AlertEvent{}, false
+}
+
+// evaluateAbsence fires when the value did not change for the For duration
+func evaluateAbsence(rule AlertRule, state *alertState, value float64, found bool, now time.Time) (AlertEvent, bool) {
+	if state.lastChange.IsZero() {
+		state.lastChange = now
+	}
+	// the first appearance of the metric counts as a change, too
+	if found && (!state.hasLast || value != state.lastValue) {
+		state.lastValue, state.hasLast = value, true
+		state.lastChange = now
+		if state.firing {
+			state.firing = false
+			return AlertEvent{Rule: rule, Value: 0, Firing: false, Time: now}, true
+		}
+	}
+	idle := now.Sub(state.lastChange)
+	if !state.firing && idle >= rule.For {
+		state.firing = true
+		return AlertEvent{Rule: rule, Value: idle.Seconds(), Firing: true, Time: now}, true
+	}
+	return AlertEvent{}, false
+}
+
+// value returns the field of the rule of the current metric and sets the default field of the rule
+func (e *AlertEvaluator) value(rule *AlertRule) (float64, bool) {
+	i := e.registry.Get(rule.Metric)
+	if i == nil {
+		return 0, false
+	}
+	values, ok := metricValues(i, ReportedPercentiles, time.Second, time.Millisecond)
+	if !ok {
+		return 0, false
+	}
+	if rule.Field == "" {
+		switch i.(type) {
+		case metrics.Gauge, metrics.GaugeFloat64:
+			rule.Field = "value"
+		default:
+			rule.Field = "count"
+		}
+	}
+	for _, v := range values {
+		if v.field == rule.Field && !math.IsNaN(v.value) {
+			return v.value, true
+		}
+	}
+	return 0, false
+}
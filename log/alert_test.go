@@ -0,0 +1,114 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type alertRecorder struct {
+	events []AlertEvent
+}
+
+func (r *alertRecorder) handle(event AlertEvent) {
+	r.events = append(r.events, event)
+}
+
+func newTestAlertEvaluator(r metrics.Registry, rule AlertRule) (*AlertEvaluator, *alertRecorder, *time.Time) {
+	recorder := &alertRecorder{}
+	now := time.Unix(0, 0)
+	e := NewAlertEvaluator([]AlertRule{rule}, WithAlertRegistry(r), WithAlertHandler(recorder.handle))
+	e.now = func() time.Time { return now }
+	return e, recorder, &now
+}
+
+func TestAlertThresholdHysteresis(t *testing.T) {
+	r := metrics.NewRegistry()
+	gauge := metrics.GetOrRegisterGauge("queue", r)
+	e, recorder, now := newTestAlertEvaluator(r, AlertRule{Name: "queue full", Metric: "queue", Limit: 100, Hysteresis: 20, For: time.Minute})
+
+	gauge.Update(150)
+	e.Evaluate()
+	assert.Empty(t, recorder.events)
+	*now = now.Add(time.Minute)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+	assert.Equal(t, AlertEvent{Rule: AlertRule{Name: "queue full", Metric: "queue", Field: "value", Limit: 100, Hysteresis: 20, For: time.Minute},
+		Value: 150, Firing: true, Time: *now}, recorder.events[0])
+
+	// within the hysteresis the rule keeps firing
+	gauge.Update(90)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+	gauge.Update(70)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 2)
+	assert.False(t, recorder.events[1].Firing)
+	assert.Equal(t, 70.0, recorder.events[1].Value)
+}
+
+func TestAlertBelowThreshold(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGaugeFloat64("hit_ratio", r).Update(0.2)
+	e, recorder, _ := newTestAlertEvaluator(r, AlertRule{Name: "low hit ratio", Metric: "hit_ratio", Below: true, Limit: 0.5})
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+	assert.True(t, recorder.events[0].Firing)
+}
+
+func TestAlertRateOfChange(t *testing.T) {
+	r := metrics.NewRegistry()
+	counter := metrics.GetOrRegisterCounter("errors", r)
+	e, recorder, now := newTestAlertEvaluator(r, AlertRule{Name: "error burst", Metric: "errors", Kind: AlertRateOfChange, Limit: 5})
+
+	e.Evaluate()
+	counter.Inc(100)
+	*now = now.Add(10 * time.Second)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+	assert.Equal(t, 10.0, recorder.events[0].Value)
+
+	*now = now.Add(10 * time.Second)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 2)
+	assert.False(t, recorder.events[1].Firing)
+}
+
+func TestAlertAbsence(t *testing.T) {
+	r := metrics.NewRegistry()
+	e, recorder, now := newTestAlertEvaluator(r, AlertRule{Name: "no heartbeats", Metric: "heartbeats", Kind: AlertAbsence, For: time.Minute})
+
+	e.Evaluate()
+	*now = now.Add(time.Minute)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+	assert.True(t, recorder.events[0].Firing)
+	assert.Equal(t, 60.0, recorder.events[0].Value)
+
+	metrics.GetOrRegisterMeter("heartbeats", r).Mark(1)
+	*now = now.Add(time.Second)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 2)
+	assert.False(t, recorder.events[1].Firing)
+	assert.Equal(t, "count", recorder.events[1].Rule.Field)
+}
+
+func TestAlertAbsenceMetricAppearsLate(t *testing.T) {
+	r := metrics.NewRegistry()
+	e, recorder, now := newTestAlertEvaluator(r, AlertRule{Name: "no heartbeats", Metric: "heartbeats", Kind: AlertAbsence, For: time.Minute})
+
+	e.Evaluate()
+	*now = now.Add(50 * time.Second)
+	metrics.GetOrRegisterMeter("heartbeats", r).Mark(1)
+	e.Evaluate()
+	*now = now.Add(30 * time.Second)
+	e.Evaluate()
+	assert.Empty(t, recorder.events, "the idle time starts when the metric appears")
+	*now = now.Add(30 * time.Second)
+	e.Evaluate()
+	assert.Len(t, recorder.events, 1)
+
+	assert.NotPanics(t, func() { e.Start(0)() })
+}
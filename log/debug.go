@@ -0,0 +1,105 @@
+package log
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// MetricSnapshot is the state of a single metric in the JSON snapshot of a registry
+type MetricSnapshot struct {
+	Name   string             `json:"name"`
+	Tags   map[string]string  `json:"tags,omitempty"`
+	Type   string             `json:"type"`
+	Values map[string]float64 `json:"values"`
+}
+
+// MetricsHandler returns a handler which responds with a JSON snapshot of all metrics of the registry,
+// e.g. to mount it at /debug/metrics. If r is nil the metrics.DefaultRegistry is used.
+// The query parameter prefix restricts the snapshot to the metrics whose name starts with it.
+// Timer durations are reported in milliseconds.
+func MetricsHandler(r metrics.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		snapshots := snapshotMetrics(r, req.URL.Query().Get("prefix"), globalNamingPolicy)
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]interface{}{"metrics": snapshots}); err != nil {
+			Logger.Warnf("failed to write metrics snapshot: %v", err)
+		}
+	})
+}
+
+// SnapshotMetrics returns the current values of all metrics of the registry whose name starts with prefix sorted by name.
+// If r is nil the metrics.DefaultRegistry is used. Timer durations are reported in milliseconds.
+// The names follow the policy of SetNamingPolicy and its env, app and host become tags.
+func SnapshotMetrics(r metrics.Registry, prefix string) []MetricSnapshot {
+	return snapshotMetrics(r, prefix, globalNamingPolicy)
+}
+
+// snapshotMetrics snapshots the registry with the names and tags of the naming policy, which may be nil
+func snapshotMetrics(r metrics.Registry, prefix string, naming *NamingPolicy) []MetricSnapshot {
+	if r == nil {
+		r = metrics.DefaultRegistry
+	}
+	snapshots := []MetricSnapshot{}
+	r.Each(func(taggedName string, i interface{}) {
+		if naming != nil {
+			taggedName = naming.MetricName(taggedName)
+		}
+		name, tags := SplitTaggedName(taggedName)
+		if !strings.HasPrefix(name, prefix) {
+			return
+		}
+		// the flush interval is only used for the per second counts which are skipped
+		values, ok := metricValues(i, ReportedPercentiles, time.Second, time.Millisecond)
+		if !ok {
+			return
+		}
+		snapshot := MetricSnapshot{Name: name, Type: metricType(i), Values: map[string]float64{}}
+		if naming != nil {
+			// the tags of the metric win over the tags of the naming policy
+			for key, value := range naming.Tags() {
+				tags = append([]Tag{{Key: key, Value: value}}, tags...)
+			}
+		}
+		if len(tags) > 0 {
+			snapshot.Tags = map[string]string{}
+			for _, tag := range tags {
+				snapshot.Tags[tag.Key] = tag.Value
+			}
+		}
+		for _, v := range values {
+			// JSON has no representation for NaN and infinity
+			if v.field == "count_ps" || math.IsNaN(v.value) || math.IsInf(v.value, 0) {
+				continue
+			}
+			snapshot.Values[v.field] = v.value
+		}
+		snapshots = append(snapshots, snapshot)
+	})
+	sort.SliceStable(snapshots, func(a, b int) bool { return snapshots[a].Name < snapshots[b].Name })
+	return snapshots
+}
+
+// metricType returns the kind of a go-metrics metric
+func metricType(i interface{}) string {
+	switch i.(type) {
+	case metrics.Counter:
+		return "counter"
+	case metrics.Gauge, metrics.GaugeFloat64:
+		return "gauge"
+	case metrics.Histogram:
+		return "histogram"
+	case metrics.Meter:
+		return "meter"
+	case metrics.Timer:
+		return "timer"
+	}
+	return "unknown"
+}
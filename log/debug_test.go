@@ -0,0 +1,59 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("jobs.done", r).Inc(3)
+	metrics.GetOrRegisterTimer(TaggedName("jobs.duration", map[string]string{"queue": "a"}), r).Update(5 * time.Millisecond)
+	metrics.GetOrRegisterGauge("other", r).Update(1)
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/metrics?prefix=jobs.", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Metrics []MetricSnapshot `json:"metrics"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Metrics, 2)
+	assert.Equal(t, MetricSnapshot{Name: "jobs.done", Type: "counter", Values: map[string]float64{"count": 3}}, body.Metrics[0])
+	assert.Equal(t, "timer", body.Metrics[1].Type)
+	assert.Equal(t, map[string]string{"queue": "a"}, body.Metrics[1].Tags)
+	assert.Equal(t, 5.0, body.Metrics[1].Values["max"])
+}
+
+func TestLogSummaryLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterHistogram(TaggedName("size", map[string]string{"env": "ci"}), r, metrics.NewUniformSample(10)).Update(2)
+	metrics.GetOrRegisterGaugeFloat64("ratio", r).Update(1.0 / 3)
+
+	lines := logSummaryLines(SnapshotMetrics(r, ""))
+	assert.Equal(t, []string{
+		"metric ratio value=0.333",
+		"metric size;env=ci 50-percentile=2 90-percentile=2 99-percentile=2 999-percentile=2 count=1 max=2 mean=2 min=2",
+	}, lines)
+}
+
+func TestStartLogReporter(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("hits", r).Inc(1)
+	var out bytes.Buffer
+	previous := Logger.Out
+	Logger.SetOutput(&out)
+	defer Logger.SetOutput(previous)
+
+	reporter := StartLogReporter(WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0))
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.Contains(t, out.String(), "metric hits count=1")
+}
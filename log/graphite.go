@@ -1,34 +1,54 @@
 package log
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
 	"net"
 	"os"
 	"time"
 
-	graphite "github.com/cyberdelia/go-metrics-graphite"
 	"github.com/rcrowley/go-metrics"
 )
 
 var GlobalMetricsPrefix string
 
+// ReportedPercentiles are the percentiles of histograms and timers reported by every backend.
+// The graphite reporter keeps its previous percentiles until SetReportedPercentiles is called.
+var ReportedPercentiles = []float64{0.5, 0.9, 0.99, 0.999}
+
+// graphitePercentiles are the percentiles reported by the graphite reporter, by default the ones it has always
+// reported, so existing dashboards and alerts on the .75-percentile and .95-percentile series keep working
+var graphitePercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
 //SetGlobalMetricsPrefix set prefix for graphite metrics
 //Should be called on application init phase
 func SetGlobalMetricsPrefix(name string) {
 	GlobalMetricsPrefix = name
 }
 
+// SetReportedPercentiles sets the percentiles of histograms and timers reported by every backend including graphite
+// Should be called on application init phase
+func SetReportedPercentiles(percentiles ...float64) {
+	ReportedPercentiles = percentiles
+	graphitePercentiles = percentiles
+}
+
 // GetHostAddr returns the TCPAddr for the given host
+// It panics if the host can not be resolved, use ResolveHostAddr to get the error instead.
 func GetHostAddr(host string) *net.TCPAddr {
-	if addr, err := net.ResolveTCPAddr("tcp", host); err == nil {
+	if addr, err := ResolveHostAddr(host); err == nil {
 		return addr
 	} else {
 		panic(err)
 	}
 }
 
+// ResolveHostAddr returns the TCPAddr for the given host or an error if it can not be resolved
+func ResolveHostAddr(host string) (*net.TCPAddr, error) {
+	return net.ResolveTCPAddr("tcp", host)
+}
+
 // GetHostname returns the machine's host name, either as determined by the system, or by using the first IP address of the first non-loopback network interface.
 // If the hostname can not be determined, “unkown-ip-address” is returned.
 func GetHostname() string {
@@ -50,54 +70,84 @@ func GetHostname() string {
 }
 
 // CreateMetricsRegistry creates a Child Registry with the hostname as prefix
+//
+// Deprecated: the reporters add the hostname with their NamingPolicy, use NewMetrics or DefaultMetrics.Child
+// to create registries for components.
 func CreateMetricsRegistry() metrics.Registry {
-	hostname := GetHostname()
-	hostname = strings.ReplaceAll(hostname, ".", "_")
-	return metrics.NewPrefixedChildRegistry(metrics.NewRegistry(), fmt.Sprintf("%s.", hostname))
+	return metrics.NewPrefixedChildRegistry(metrics.NewRegistry(), fmt.Sprintf("%s.", SanitizeSegment(GetHostname())))
 }
 
-// StartReporter starts the graphite reporter
-func StartReporter(graphiteHost string, appName string) {
-	addr := GetHostAddr(graphiteHost)
-	go metrics.CaptureRuntimeMemStats(metrics.DefaultRegistry, 5*time.Second) // updates the RuntimeMemStats every 5 seconds, the registy does not matter
-	go graphite.Graphite(metrics.DefaultRegistry, 10*time.Second, fmt.Sprintf("%s.%s", GlobalMetricsPrefix, appName), addr)
+// StartReporter starts the graphite reporter which sends the default registry every 10 seconds
+// to the given graphite host and captures the runtime memory stats every 5 seconds.
+// The metric paths are <GlobalMetricsPrefix>.<appName>.<metric> unless a NamingPolicy is set with
+// WithNamingPolicy or SetNamingPolicy.
+// Data points which can not be delivered are buffered and retried with backoff, the state of the
+// delivery is reported as graphite.reporter.* metrics. The graphite host is resolved again on every
+// reconnect. WithGraphiteProtocol selects plaintext over tcp (default), udp or pickle.
+// Use Stop on the returned Reporter to shut it down with a final flush.
+func StartReporter(graphiteHost string, appName string, opts ...ReporterOption) (*Reporter, error) {
+	if _, err := ResolveHostAddr(graphiteHost); err != nil {
+		return nil, err
+	}
+	cfg := newReporterConfig(opts)
+	naming := cfg.namingPolicy(appName)
+	sender := newGraphiteSender(graphiteHost, cfg)
+	flush := func(ctx context.Context) error {
+		return sender.deliver(ctx, graphiteLines(cfg.registry, naming, cfg.flushInterval, cfg.tagMode, time.Now()))
+	}
+	return startReporter(cfg, flush, sender.close), nil
+}
+
+// graphiteLines renders all metrics of the registry in the graphite plaintext protocol
+func graphiteLines(r metrics.Registry, naming NamingPolicy, flushInterval time.Duration, tagMode TagMode, now time.Time) []string {
+	lines := []string{}
+	timestamp := now.Unix()
+	r.Each(func(name string, i interface{}) {
+		values, ok := metricValues(i, graphitePercentiles, flushInterval, time.Nanosecond)
+		if !ok {
+			Logger.Debugf("unable to report metric %s of type %T", name, i)
+			return
+		}
+		for _, v := range values {
+			lines = append(lines, fmt.Sprintf("%s %s %d", taggedPath("", naming.metricPath(name), v.field, tagMode), formatMetricValue(v.value), timestamp))
+		}
+	})
+	return lines
 }
 
 // GetCounter creates a new counter or returns the existing counter with the given name from the default registry.
 func GetCounter(metricsName string) metrics.Counter {
-	return metrics.GetOrRegisterCounter(metricsName, metrics.DefaultRegistry)
+	return DefaultMetrics.GetCounter(metricsName)
 }
 
 // GetHistogram creates a new histogram (or returns an existing one with the given name) with an exponential decay sample with default parameters.
 func GetHistogram(metricName string) metrics.Histogram {
-	return metrics.GetOrRegisterHistogram(metricName, metrics.DefaultRegistry, metrics.NewExpDecaySample(1028, 0.015))
+	return DefaultMetrics.GetHistogram(metricName)
 }
 
 // GetMeter creates a new meter or returns the existing meter with the given name from the default registry.
 func GetMeter(metricName string) metrics.Meter {
-	return metrics.GetOrRegisterMeter(metricName, metrics.DefaultRegistry)
+	return DefaultMetrics.GetMeter(metricName)
 }
 
 // CreateGauge creates a new gauge that reports values returned by the given function.
 func CreateGauge(metricName string, value func() int64) {
-	gauge := metrics.NewFunctionalGauge(value)
-	metrics.Register(metricName, gauge)
+	DefaultMetrics.CreateGauge(metricName, value)
 }
 
 // CreateGauge creates a new gauge or returns the existing gauge with the given name from the default registry.
 func GetGauge(metricName string) metrics.Gauge {
-	return metrics.GetOrRegisterGauge(metricName, metrics.DefaultRegistry)
+	return DefaultMetrics.GetGauge(metricName)
+}
+
+// GetGaugeFloat64 creates a new float gauge or returns the existing float gauge with the given name from the default registry.
+func GetGaugeFloat64(metricName string) metrics.GaugeFloat64 {
+	return DefaultMetrics.GetGaugeFloat64(metricName)
 }
 
 // CreateTopicMeterMap creates a map of Meters (topic -> Meter).
 func CreateTopicMeterMap(fmtString string, topics []string) map[string]metrics.Meter {
-	meterMap := map[string]metrics.Meter{}
-	for _, topic := range topics {
-		meterName := fmt.Sprintf(fmtString, topic)
-		Logger.Infof("created meter: %s", meterName)
-		meterMap[topic] = metrics.GetOrRegisterMeter(meterName, metrics.DefaultRegistry)
-	}
-	return meterMap
+	return DefaultMetrics.CreateTopicMeterMap(fmtString, topics)
 }
 
 func MeterMapToSlice(meterMap map[string]metrics.Meter) []metrics.Meter {
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GraphiteProtocol is the wire protocol of the graphite reporter
+type GraphiteProtocol int
+
+const (
+	// GraphitePlaintext sends plaintext lines over tcp, usually to port 2003
+	GraphitePlaintext GraphiteProtocol = iota
+	// GraphiteUDP sends plaintext lines in udp packets, usually to port 2003. Lines which can not be sent are
+	// dropped instead of buffered, so it suits high frequency services which must not block on the backend.
+	GraphiteUDP
+	// GraphitePickle sends batches in the pickle protocol over tcp, usually to port 2004
+	GraphitePickle
+)
+
+// WithGraphiteProtocol sets the wire protocol of the graphite reporter (default GraphitePlaintext).
+// The batch size of WithBatchSize is the number of data points per pickle message.
+func WithGraphiteProtocol(protocol GraphiteProtocol) ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.graphiteProtocol = protocol
+	}
+}
+
+// Opcodes of the pickle protocol 2, see the pickletools module of python
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleBinUnicode = 'X'
+	pickleBinInt     = 'J'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleAppends    = 'e'
+	pickleStop       = '.'
+)
+
+// picklePayload encodes plaintext lines as a pickled list of (path, (timestamp, value)) tuples
+// prefixed with the length header expected by carbon, invalid lines are skipped
+func picklePayload(lines []string) []byte {
+	var body bytes.Buffer
+	body.Write([]byte{pickleProto, 2, pickleEmptyList, pickleMark})
+	for _, line := range lines {
+		path, value, timestamp, err := parseGraphiteLine(line)
+		if err != nil {
+			Logger.Debugf("skipping graphite line: %v", err)
+			continue
+		}
+		body.WriteByte(pickleBinUnicode)
+		binary.Write(&body, binary.LittleEndian, uint32(len(path)))
+		body.WriteString(path)
+		if timestamp >= math.MinInt32 && timestamp <= math.MaxInt32 {
+			body.WriteByte(pickleBinInt)
+			binary.Write(&body, binary.LittleEndian, int32(timestamp))
+		} else {
+			body.WriteByte(pickleBinFloat)
+			binary.Write(&body, binary.BigEndian, float64(timestamp))
+		}
+		body.WriteByte(pickleBinFloat)
+		binary.Write(&body, binary.BigEndian, value)
+		body.Write([]byte{pickleTuple2, pickleTuple2})
+	}
+	body.Write([]byte{pickleAppends, pickleStop})
+
+	payload := make([]byte, 4, 4+body.Len())
+	binary.BigEndian.PutUint32(payload, uint32(body.Len()))
+	return append(payload, body.Bytes()...)
+}
+
+// parseGraphiteLine splits a plaintext line "path value timestamp"
+func parseGraphiteLine(line string) (string, float64, int64, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return "", 0, 0, fmt.Errorf("invalid graphite line %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid graphite line %q: %w", line, err)
+	}
+	timestamp, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("invalid graphite line %q: %w", line, err)
+	}
+	return fields[0], value, timestamp, nil
+}
@@ -0,0 +1,72 @@
+package log
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPicklePayload(t *testing.T) {
+	payload := picklePayload([]string{"a.b 1.5 100", "invalid line"})
+	assert.Equal(t, []byte{
+		0, 0, 0, 30, // length header
+		0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'J', 100, 0, 0, 0,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86, 'e', '.',
+	}, payload)
+}
+
+func TestGraphiteSenderPickle(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header))
+		io.ReadFull(conn, body)
+		received <- body
+	}()
+
+	sender := newTestGraphiteSender(listener.Addr().String(), WithGraphiteProtocol(GraphitePickle))
+	defer sender.close()
+	assert.Nil(t, sender.deliver(context.Background(), []string{"a.b 1.5 100", "c 2 200"}))
+	select {
+	case body := <-received:
+		assert.Equal(t, byte(0x80), body[0])
+		assert.Equal(t, byte('.'), body[len(body)-1])
+	case <-time.After(time.Second):
+		t.Fatal("no pickle message received")
+	}
+}
+
+func TestStartReporterUDP(t *testing.T) {
+	addr, read := listenStatsd(t)
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("queue", r).Update(3)
+	reporter, err := StartReporter(addr, "app", WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0),
+		WithNamingPolicy(NamingPolicy{}), WithGraphiteProtocol(GraphiteUDP))
+	assert.Nil(t, err)
+	assert.Nil(t, reporter.Flush(context.Background()))
+	lines := strings.Join(read(), "\n")
+	assert.Regexp(t, `(^|\n)app\.queue\.value 3 \d+(\n|$)`, lines)
+	assert.Regexp(t, `(^|\n)app\.graphite\.reporter\.dropped\.count 0 \d+(\n|$)`, lines)
+	assert.Nil(t, reporter.Stop(context.Background()))
+}
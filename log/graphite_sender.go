@@ -0,0 +1,165 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// graphiteSender delivers lines of the graphite plaintext protocol over a persistent tcp connection,
+// as pickle batches over tcp or in udp packets.
+// Lines which can not be delivered over tcp are buffered up to the configured buffer size and retried with
+// an exponential backoff, the oldest lines are dropped when the buffer is full. Lines which can not be
+// delivered over udp are dropped.
+// It is not safe for concurrent use, the Reporter serializes all flushes.
+type graphiteSender struct {
+	host       string
+	protocol   GraphiteProtocol
+	bufferSize int
+	batchSize  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	conn    net.Conn
+	queue   []string
+	backoff time.Duration
+
+	queueDepth       metrics.Gauge
+	dropped          metrics.Counter
+	connectionErrors metrics.Counter
+	sent             metrics.Counter
+}
+
+func newGraphiteSender(host string, cfg reporterConfig) *graphiteSender {
+	return &graphiteSender{
+		host:             host,
+		protocol:         cfg.graphiteProtocol,
+		bufferSize:       cfg.bufferSize,
+		batchSize:        cfg.batchSize,
+		minBackoff:       cfg.minBackoff,
+		maxBackoff:       cfg.maxBackoff,
+		queueDepth:       metrics.GetOrRegisterGauge("graphite.reporter.queue_depth", cfg.registry),
+		dropped:          metrics.GetOrRegisterCounter("graphite.reporter.dropped", cfg.registry),
+		connectionErrors: metrics.GetOrRegisterCounter("graphite.reporter.connection_errors", cfg.registry),
+		sent:             metrics.GetOrRegisterCounter("graphite.reporter.sent", cfg.registry),
+	}
+}
+
+// enqueue adds lines to the buffer and drops the oldest lines if the buffer size is exceeded
+func (s *graphiteSender) enqueue(lines []string) {
+	s.queue = append(s.queue, lines...)
+	if overflow := len(s.queue) - s.bufferSize; overflow > 0 {
+		s.queue = append(s.queue[:0], s.queue[overflow:]...)
+		s.dropped.Inc(int64(overflow))
+	}
+	s.queueDepth.Update(int64(len(s.queue)))
+}
+
+// deliver enqueues the lines and sends the whole buffer in batches.
+// Failed sends are retried with backoff until the buffer is empty or ctx is done.
+func (s *graphiteSender) deliver(ctx context.Context, lines []string) error {
+	s.enqueue(lines)
+	for len(s.queue) > 0 {
+		err := s.sendBatch(ctx)
+		if err == nil {
+			s.backoff = 0
+			continue
+		}
+		s.connectionErrors.Inc(1)
+		s.close()
+		s.backoff = nextBackoff(s.backoff, s.minBackoff, s.maxBackoff)
+		Logger.Debugf("graphite send failed, retrying in %s: %v", s.backoff, err)
+		timer := time.NewTimer(s.backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%d graphite lines still buffered: %w", len(s.queue), err)
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+func (s *graphiteSender) sendBatch(ctx context.Context) error {
+	n := s.batchSize
+	if n > len(s.queue) {
+		n = len(s.queue)
+	}
+	err := s.write(ctx, s.queue[:n])
+	if err != nil && s.protocol == GraphiteUDP {
+		// udp is fire and forget, the lines are not retried
+		Logger.Debugf("graphite udp send failed, dropping %d lines: %v", n, err)
+		s.connectionErrors.Inc(1)
+		s.dropped.Inc(int64(n))
+		s.close()
+		s.queue = s.queue[n:]
+		s.queueDepth.Update(int64(len(s.queue)))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.queue = s.queue[n:]
+	s.queueDepth.Update(int64(len(s.queue)))
+	s.sent.Inc(int64(n))
+	return nil
+}
+
+// write sends the lines in the protocol of the sender
+func (s *graphiteSender) write(ctx context.Context, lines []string) error {
+	var payloads [][]byte
+	switch s.protocol {
+	case GraphiteUDP:
+		payloads = packLines(lines, udpMaxPacketSize)
+	case GraphitePickle:
+		payloads = [][]byte{picklePayload(lines)}
+	default:
+		payloads = [][]byte{[]byte(strings.Join(lines, "\n") + "\n")}
+	}
+
+	if s.conn == nil {
+		network := "tcp"
+		if s.protocol == GraphiteUDP {
+			network = "udp"
+		}
+		dialer := net.Dialer{}
+		conn, err := dialer.DialContext(ctx, network, s.host)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	} else {
+		s.conn.SetWriteDeadline(time.Time{})
+	}
+	for _, payload := range payloads {
+		if _, err := s.conn.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *graphiteSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// nextBackoff doubles the current backoff within the given bounds
+func nextBackoff(current, min, max time.Duration) time.Duration {
+	if current < min {
+		return min
+	}
+	if current*2 > max {
+		return max
+	}
+	return current * 2
+}
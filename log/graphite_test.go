@@ -0,0 +1,167 @@
+package log
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// graphiteStandIn is a local tcp server which records all received lines
+type graphiteStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	lines    []string
+}
+
+func newGraphiteStandIn(t *testing.T) *graphiteStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &graphiteStandIn{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *graphiteStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		s.mu.Lock()
+		s.lines = append(s.lines, scanner.Text())
+		s.mu.Unlock()
+	}
+}
+
+func (s *graphiteStandIn) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// hasLine reports whether a line starting with prefix has been received within a second
+func (s *graphiteStandIn) hasLine(prefix string) bool {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		for _, line := range s.lines {
+			if strings.HasPrefix(line, prefix) {
+				s.mu.Unlock()
+				return true
+			}
+		}
+		s.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestStartReporterStopFlushes(t *testing.T) {
+	server := newGraphiteStandIn(t)
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("test.reporter.stop", r).Inc(5)
+
+	reporter, err := StartReporter(server.Addr(), "app", WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0),
+		WithNamingPolicy(NamingPolicy{}))
+	assert.Nil(t, err)
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.True(t, server.hasLine("app.test.reporter.stop.count 5 "))
+	assert.Equal(t, ErrReporterStopped, reporter.Stop(context.Background()))
+}
+
+func TestStartReporterInvalidHost(t *testing.T) {
+	reporter, err := StartReporter("missing-port", "app")
+	assert.NotNil(t, err)
+	assert.Nil(t, reporter)
+}
+
+func TestDefaultNamingPolicy(t *testing.T) {
+	assert.Equal(t, "app", newReporterConfig(nil).namingPolicy("app").Prefix())
+	SetGlobalMetricsPrefix("prod")
+	defer SetGlobalMetricsPrefix("")
+	legacy := newReporterConfig(nil).namingPolicy("my app")
+	assert.Equal(t, "prod.my app", legacy.Prefix(), "no host segment and no sanitising without a policy")
+	assert.Equal(t, "kafka.my topic", legacy.MetricName("kafka.my topic"))
+
+	SetNamingPolicy(NewNamingPolicy("prod", ""))
+	defer func() { globalNamingPolicy = nil }()
+	assert.Equal(t, NamingPolicy{Env: "prod", App: "app", Host: GetHostname()}, newReporterConfig(nil).namingPolicy("app"))
+	assert.Equal(t, NamingPolicy{Env: "dev", App: "app"},
+		newReporterConfig([]ReporterOption{WithNamingPolicy(NamingPolicy{Env: "dev"})}).namingPolicy("app"))
+}
+
+func newTestGraphiteSender(host string, opts ...ReporterOption) *graphiteSender {
+	opts = append([]ReporterOption{WithRegistry(metrics.NewRegistry()), WithRetryBackoff(time.Millisecond, 10*time.Millisecond)}, opts...)
+	return newGraphiteSender(host, newReporterConfig(opts))
+}
+
+func TestGraphiteSenderBuffersWhileUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	sender := newTestGraphiteSender(unreachable)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NotNil(t, sender.deliver(ctx, []string{"a.count 1 1", "b.count 2 1"}))
+	assert.Equal(t, int64(2), sender.queueDepth.Value())
+	assert.True(t, sender.connectionErrors.Count() > 0)
+
+	server := newGraphiteStandIn(t)
+	sender.host = server.Addr()
+	assert.Nil(t, sender.deliver(context.Background(), []string{"c.count 3 1"}))
+	defer sender.close()
+	assert.Equal(t, int64(0), sender.queueDepth.Value())
+	assert.Equal(t, int64(3), sender.sent.Count())
+	assert.True(t, server.hasLine("a.count 1 1"))
+	assert.True(t, server.hasLine("c.count 3 1"))
+}
+
+func TestGraphiteSenderDropsOldestLines(t *testing.T) {
+	sender := newTestGraphiteSender("127.0.0.1:0", WithBufferSize(3))
+	sender.enqueue([]string{"1", "2", "3", "4", "5"})
+	assert.Equal(t, []string{"3", "4", "5"}, sender.queue)
+	assert.Equal(t, int64(2), sender.dropped.Count())
+	assert.Equal(t, int64(3), sender.queueDepth.Value())
+}
+
+func TestGraphiteSenderBatches(t *testing.T) {
+	server := newGraphiteStandIn(t)
+	sender := newTestGraphiteSender(server.Addr(), WithBatchSize(2))
+	defer sender.close()
+	assert.Nil(t, sender.deliver(context.Background(), []string{"a 1 1", "b 1 1", "c 1 1", "d 1 1", "e 1 1"}))
+	assert.Equal(t, int64(5), sender.sent.Count())
+	assert.True(t, server.hasLine("e 1 1"))
+}
+
+func TestGraphiteLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterMeter("events", r).Mark(2)
+	metrics.GetOrRegisterHistogram("size", r, metrics.NewUniformSample(10)).Update(4)
+	lines := graphiteLines(r, NamingPolicy{App: "app"}, 10*time.Second, TagsAsGraphiteTags, time.Unix(100, 0))
+	assert.Contains(t, lines, "app.events.count 2 100")
+	assert.Contains(t, lines, "app.size.99-percentile 4 100")
+	assert.Contains(t, lines, "app.size.999-percentile 4 100")
+	assert.Contains(t, lines, "app.size.75-percentile 4 100", "graphite keeps its previous percentiles")
+	assert.Contains(t, lines, "app.size.95-percentile 4 100")
+	assert.NotContains(t, lines, "app.size.90-percentile 4 100")
+
+	previous, previousGraphite := ReportedPercentiles, graphitePercentiles
+	defer func() { ReportedPercentiles, graphitePercentiles = previous, previousGraphite }()
+	SetReportedPercentiles(0.9)
+	lines = graphiteLines(r, NamingPolicy{App: "app"}, 10*time.Second, TagsAsGraphiteTags, time.Unix(100, 0))
+	assert.Contains(t, lines, "app.size.90-percentile 4 100")
+	assert.NotContains(t, lines, "app.size.75-percentile 4 100")
+}
@@ -0,0 +1,246 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// flushRecorder is a statusRecorder of a ResponseWriter which implements http.Flusher
+type flushRecorder struct {
+	*statusRecorder
+	http.Flusher
+}
+
+// hijackRecorder is a statusRecorder of a ResponseWriter which implements http.Hijacker, e.g. for websockets
+type hijackRecorder struct {
+	*statusRecorder
+	http.Hijacker
+}
+
+// flushHijackRecorder is a statusRecorder of a ResponseWriter which implements http.Flusher and http.Hijacker
+type flushHijackRecorder struct {
+	*statusRecorder
+	http.Flusher
+	http.Hijacker
+}
+
+// recordStatus wraps w in a statusRecorder which implements http.Flusher and http.Hijacker only if w does
+func recordStatus(w http.ResponseWriter) (http.ResponseWriter, *statusRecorder) {
+	recorder := &statusRecorder{ResponseWriter: w}
+	flusher, canFlush := w.(http.Flusher)
+	hijacker, canHijack := w.(http.Hijacker)
+	switch {
+	case canFlush && canHijack:
+		return &flushHijackRecorder{statusRecorder: recorder, Flusher: flusher, Hijacker: hijacker}, recorder
+	case canFlush:
+		return &flushRecorder{statusRecorder: recorder, Flusher: flusher}, recorder
+	case canHijack:
+		return &hijackRecorder{statusRecorder: recorder, Hijacker: hijacker}, recorder
+	}
+	return recorder, recorder
+}
+
+// statusClass returns the class of a status code, e.g. 2xx
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// InstrumentHandler wraps next and records the requests of the given route in the default registry:
+// the timer http.server.requests;route=<route> with the count and latency distribution and the meters
+// http.server.responses;route=<route>;status=<class> with the number of responses per status class.
+func InstrumentHandler(route string, next http.Handler) http.Handler {
+	return DefaultMetrics.InstrumentHandler(route, next)
+}
+
+func instrumentHandler(m *Metrics, route string, next http.Handler) http.Handler {
+	timer := m.GetTaggedTimer("http.server.requests", map[string]string{"route": route})
+	responses := newStatusMeters(m, "http.server.responses", map[string]string{"route": route})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped, recorder := recordStatus(w)
+		defer func() {
+			timer.UpdateSince(start)
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			responses.get(statusClass(status)).Mark(1)
+		}()
+		next.ServeHTTP(wrapped, r)
+	})
+}
+
+// statusMeters caches the meters of the status classes of a route or host
+type statusMeters struct {
+	metrics *Metrics
+	name    string
+	tags    map[string]string
+
+	mu     sync.Mutex
+	meters map[string]metrics.Meter
+}
+
+func newStatusMeters(m *Metrics, name string, tags map[string]string) *statusMeters {
+	return &statusMeters{metrics: m, name: name, tags: tags, meters: map[string]metrics.Meter{}}
+}
+
+// get returns the meter of the status class and registers it on first use
+func (s *statusMeters) get(class string) metrics.Meter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meter, ok := s.meters[class]
+	if !ok {
+		tags := make(map[string]string, len(s.tags)+1)
+		for key, value := range s.tags {
+			tags[key] = value
+		}
+		tags["status"] = class
+		meter = s.metrics.GetTaggedMeter(s.name, tags)
+		s.meters[class] = meter
+	}
+	return meter
+}
+
+// defaultMaxClientHosts is the default number of hosts an instrumented RoundTripper records separately
+const defaultMaxClientHosts = 100
+
+// RoundTripperOption configures InstrumentRoundTripper
+type RoundTripperOption func(*instrumentedRoundTripper)
+
+// WithHostLabel maps the host of a request, e.g. "api.example.com:443", to the value of the host tag.
+// Use it to group hosts into a fixed set of names, e.g. per service.
+func WithHostLabel(label func(host string) string) RoundTripperOption {
+	return func(t *instrumentedRoundTripper) {
+		if label != nil {
+			t.hostLabel = label
+		}
+	}
+}
+
+// WithMaxHosts limits the number of host tag values (default 100).
+// Further hosts are recorded with the host tag OverflowLabelValue.
+func WithMaxHosts(n int) RoundTripperOption {
+	return func(t *instrumentedRoundTripper) {
+		if n > 0 {
+			t.maxHosts = n
+		}
+	}
+}
+
+// clientHostMetrics are the metrics of the outgoing requests to a single host tag value
+type clientHostMetrics struct {
+	requests  metrics.Timer
+	responses *statusMeters
+}
+
+// instrumentedRoundTripper records the outgoing requests per host
+type instrumentedRoundTripper struct {
+	metrics   *Metrics
+	next      http.RoundTripper
+	hostLabel func(host string) string
+	maxHosts  int
+
+	mu         sync.Mutex
+	hosts      map[string]*clientHostMetrics
+	overflowed bool
+}
+
+func newInstrumentedRoundTripper(m *Metrics, next http.RoundTripper, opts []RoundTripperOption) *instrumentedRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &instrumentedRoundTripper{
+		metrics:   m,
+		next:      next,
+		hostLabel: func(host string) string { return host },
+		maxHosts:  defaultMaxClientHosts,
+		hosts:     map[string]*clientHostMetrics{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// InstrumentRoundTripper wraps next (http.DefaultTransport if nil) and records the outgoing requests per host
+// in the default registry: the timer http.client.requests;host=<host> with the count and latency distribution
+// and the meters http.client.responses;host=<host>;status=<class> with the number of responses per status class.
+// Requests which fail without a response are counted with the status class "error".
+// At most 100 hosts are recorded separately, see WithMaxHosts and WithHostLabel.
+func InstrumentRoundTripper(next http.RoundTripper, opts ...RoundTripperOption) http.RoundTripper {
+	return DefaultMetrics.InstrumentRoundTripper(next, opts...)
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *instrumentedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	host := t.host(req.URL.Host)
+	host.requests.UpdateSince(start)
+	status := "error"
+	if err == nil {
+		status = statusClass(resp.StatusCode)
+	}
+	host.responses.get(status).Mark(1)
+	return resp, err
+}
+
+// host returns the metrics of the host tag of the given host and registers them on first use
+func (t *instrumentedRoundTripper) host(host string) *clientHostMetrics {
+	label := t.hostLabel(host)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m, ok := t.hosts[label]; ok {
+		return m
+	}
+	if len(t.hosts) >= t.maxHosts {
+		if !t.overflowed {
+			Logger.Warnf("http client metrics exceeded the max number of %d hosts, recording further hosts as %q",
+				t.maxHosts, OverflowLabelValue)
+			t.overflowed = true
+		}
+		label = OverflowLabelValue
+		if m, ok := t.hosts[label]; ok {
+			return m
+		}
+	}
+	tags := map[string]string{"host": label}
+	m := &clientHostMetrics{
+		requests:  t.metrics.GetTaggedTimer("http.client.requests", tags),
+		responses: newStatusMeters(t.metrics, "http.client.responses", tags),
+	}
+	t.hosts[label] = m
+	return m
+}
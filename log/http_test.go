@@ -0,0 +1,116 @@
+package log
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	defer metrics.Unregister("http.server.requests;route=/test")
+	defer metrics.Unregister("http.server.responses;route=/test;status=4xx")
+	defer metrics.Unregister("http.server.responses;route=/test;status=2xx")
+
+	handler := InstrumentHandler("/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test?fail=1", nil))
+
+	assert.Equal(t, int64(2), GetTimer("http.server.requests;route=/test").Count())
+	assert.Equal(t, int64(1), GetMeter("http.server.responses;route=/test;status=2xx").Count())
+	assert.Equal(t, int64(1), GetMeter("http.server.responses;route=/test;status=4xx").Count())
+}
+
+func TestInstrumentRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+	defer metrics.Unregister(TaggedName("http.client.requests", map[string]string{"host": host}))
+	defer metrics.Unregister(TaggedName("http.client.responses", map[string]string{"host": host, "status": "5xx"}))
+	defer metrics.Unregister("http.client.requests;host=invalid.invalid")
+	defer metrics.Unregister("http.client.responses;host=invalid.invalid;status=error")
+
+	client := &http.Client{Transport: InstrumentRoundTripper(nil)}
+	resp, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	_, err = client.Do(&http.Request{Method: http.MethodGet, URL: &url.URL{Scheme: "http", Host: "invalid.invalid"}})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, int64(1), GetTimer(TaggedName("http.client.requests", map[string]string{"host": host})).Count())
+	assert.Equal(t, int64(1), GetMeter(TaggedName("http.client.responses", map[string]string{"host": host, "status": "5xx"})).Count())
+	assert.Equal(t, int64(1), GetMeter("http.client.responses;host=invalid.invalid;status=error").Count())
+}
+
+func TestInstrumentHandlerForwardsInterfaces(t *testing.T) {
+	defer metrics.Unregister("http.server.requests;route=/ws")
+	defer metrics.Unregister("http.server.responses;route=/ws;status=2xx")
+
+	var canFlush, canHijack bool
+	handler := InstrumentHandler("/ws", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, canFlush = w.(http.Flusher)
+		_, canHijack = w.(http.Hijacker)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.True(t, canFlush)
+	assert.True(t, canHijack, "websocket upgrades need the hijacker of the server")
+
+	handler.ServeHTTP(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.False(t, canFlush, "the flusher is only claimed if the wrapped writer supports it")
+	assert.False(t, canHijack)
+}
+
+func TestInstrumentRoundTripperMaxHosts(t *testing.T) {
+	m := NewMetrics(metrics.NewRegistry())
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	client := &http.Client{Transport: m.InstrumentRoundTripper(transport, WithMaxHosts(2))}
+	for _, host := range []string{"a", "b", "c", "d", "a"} {
+		resp, err := client.Get("http://" + host + "/")
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int64(2), m.GetTimer("http.client.requests;host=a").Count())
+	assert.Equal(t, int64(1), m.GetTimer("http.client.requests;host=b").Count())
+	assert.Equal(t, int64(2), m.GetMeter("http.client.responses;host=other;status=2xx").Count())
+	assert.Nil(t, m.Registry().Get("http.client.requests;host=c"))
+
+	client = &http.Client{Transport: m.InstrumentRoundTripper(transport,
+		WithHostLabel(func(host string) string { return strings.SplitN(host, ".", 2)[0] }))}
+	for _, host := range []string{"api.eu.example.com", "api.us.example.com"} {
+		resp, err := client.Get("http://" + host + "/")
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int64(2), m.GetTimer("http.client.requests;host=api").Count())
+}
+
+// roundTripperFunc is a http.RoundTripper which calls the func
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", statusClass(204))
+	assert.Equal(t, "5xx", statusClass(503))
+	assert.Equal(t, "unknown", statusClass(0))
+}
@@ -0,0 +1,243 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// InfluxConfig configures the InfluxDB reporter.
+// Set Database to use the v1 write API or Org and Bucket to use the v2 write API.
+type InfluxConfig struct {
+	URL string // base url of the InfluxDB server, e.g. http://localhost:8086
+
+	Database        string // v1 database
+	RetentionPolicy string // v1 retention policy, optional
+	Username        string // v1 username, optional
+	Password        string // v1 password, optional
+
+	Org    string // v2 organization
+	Bucket string // v2 bucket
+	Token  string // v2 API token
+
+	Gzip bool // compress the request bodies
+}
+
+func (c InfluxConfig) writeURL() (string, error) {
+	if c.URL == "" {
+		return "", errors.New("influx url not set")
+	}
+	query := url.Values{}
+	query.Set("precision", "ns")
+	switch {
+	case c.Bucket != "" || c.Org != "":
+		if c.Bucket == "" || c.Org == "" {
+			return "", errors.New("influx v2 requires org and bucket")
+		}
+		query.Set("org", c.Org)
+		query.Set("bucket", c.Bucket)
+		return strings.TrimSuffix(c.URL, "/") + "/api/v2/write?" + query.Encode(), nil
+	case c.Database != "":
+		query.Set("db", c.Database)
+		if c.RetentionPolicy != "" {
+			query.Set("rp", c.RetentionPolicy)
+		}
+		return strings.TrimSuffix(c.URL, "/") + "/write?" + query.Encode(), nil
+	}
+	return "", errors.New("influx database or org and bucket not set")
+}
+
+// influxWriter posts batches of line protocol to InfluxDB
+type influxWriter struct {
+	config     InfluxConfig
+	writeURL   string
+	client     *http.Client
+	batchSize  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// StartInfluxReporter starts a reporter which writes the default registry every 10 seconds in the InfluxDB
+// line protocol and captures the runtime memory stats every 5 seconds, just like StartReporter.
+// Every metric becomes a measurement with its values as fields, the env, app and host of the NamingPolicy
+// (the app name and hostname without a policy) and the tags of tagged metrics become tags.
+// Failed writes are retried with backoff.
+func StartInfluxReporter(influx InfluxConfig, appName string, opts ...ReporterOption) (*Reporter, error) {
+	writeURL, err := influx.writeURL()
+	if err != nil {
+		return nil, err
+	}
+	cfg := newReporterConfig(opts)
+	writer := &influxWriter{
+		config:     influx,
+		writeURL:   writeURL,
+		client:     &http.Client{},
+		batchSize:  cfg.batchSize,
+		minBackoff: cfg.minBackoff,
+		maxBackoff: cfg.maxBackoff,
+	}
+	naming := cfg.namingPolicy(appName)
+	if cfg.explicitNamingPolicy() == nil {
+		naming = NamingPolicy{App: appName, Host: GetHostname(), Sanitize: keepSegment}
+	}
+	flush := func(ctx context.Context) error {
+		return writer.write(ctx, influxLines(cfg.registry, naming, cfg.flushInterval, time.Now()))
+	}
+	return startReporter(cfg, flush, nil), nil
+}
+
+// write sends the lines in batches, a failed batch does not stop the following ones
+func (w *influxWriter) write(ctx context.Context, lines []string) error {
+	var errs []string
+	for start := 0; start < len(lines); start += w.batchSize {
+		end := start + w.batchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := w.writeBatch(ctx, []byte(strings.Join(lines[start:end], "\n")+"\n")); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d influx batches failed: %s", len(errs), (len(lines)+w.batchSize-1)/w.batchSize, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// writeBatch posts a single batch and retries server errors and connection errors with backoff until ctx is done
+func (w *influxWriter) writeBatch(ctx context.Context, body []byte) error {
+	if w.config.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	var backoff time.Duration
+	for {
+		retry, err := w.post(ctx, body)
+		if err == nil || !retry {
+			return err
+		}
+		backoff = nextBackoff(backoff, w.minBackoff, w.maxBackoff)
+		Logger.Debugf("influx write failed, retrying in %s: %v", backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// post sends the body once and reports whether a failure is worth a retry
+func (w *influxWriter) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if w.config.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.config.Token)
+	} else if w.config.Username != "" {
+		req.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("influx write failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// influxLines renders all metrics of the registry in the InfluxDB line protocol
+func influxLines(r metrics.Registry, naming NamingPolicy, flushInterval time.Duration, now time.Time) []string {
+	lines := []string{}
+	tags := naming.Tags()
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	r.Each(func(taggedName string, i interface{}) {
+		values, ok := metricValues(i, ReportedPercentiles, flushInterval, time.Nanosecond)
+		if !ok {
+			Logger.Debugf("unable to report metric %s of type %T", taggedName, i)
+			return
+		}
+		name, metricTags := SplitTaggedName(naming.MetricName(taggedName))
+		allTags := make([]Tag, 0, len(tags)+len(metricTags))
+		// the tags of the metric win over the tags of the naming policy with the same key
+		tagged := map[string]bool{}
+		for _, tag := range metricTags {
+			tagged[tag.Key] = true
+		}
+		for key, value := range tags {
+			if !tagged[key] {
+				allTags = append(allTags, Tag{Key: key, Value: value})
+			}
+		}
+		allTags = append(allTags, metricTags...)
+		sort.Slice(allTags, func(a, b int) bool { return allTags[a].Key < allTags[b].Key })
+
+		var sb strings.Builder
+		sb.WriteString(influxEscape(name, ", "))
+		for _, tag := range allTags {
+			if tag.Value == "" {
+				continue
+			}
+			sb.WriteString("," + influxEscape(tag.Key, ", =") + "=" + influxEscape(tag.Value, ", ="))
+		}
+		fields := make([]string, 0, len(values))
+		for _, v := range values {
+			// the line protocol has no representation for NaN and infinity
+			if math.IsNaN(v.value) || math.IsInf(v.value, 0) {
+				continue
+			}
+			fields = append(fields, influxEscape(v.field, ", =")+"="+formatMetricValue(v.value))
+		}
+		if len(fields) == 0 {
+			return
+		}
+		sb.WriteString(" " + strings.Join(fields, ",") + " " + timestamp)
+		lines = append(lines, sb.String())
+	})
+	return lines
+}
+
+// influxEscape escapes the given special characters with a backslash
+func influxEscape(s string, special string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(special, c) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+package log
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge(TaggedName("queue size", map[string]string{"topic": "a,b"}), r).Update(4)
+	lines := influxLines(r, NamingPolicy{App: "bidder", Host: "web1"}, time.Second, time.Unix(1, 0))
+	assert.Equal(t, []string{`queue_size,app=bidder,host=web1,topic=a\,b value=4 1000000000`}, lines)
+}
+
+func TestInfluxLinesTagCollision(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge(TaggedName("proxy", map[string]string{"host": "10.0.0.1"}), r).Update(1)
+	lines := influxLines(r, NamingPolicy{App: "bidder", Host: "web1"}, time.Second, time.Unix(1, 0))
+	assert.Equal(t, []string{`proxy,app=bidder,host=10.0.0.1 value=1 1000000000`}, lines)
+}
+
+func TestInfluxConfigWriteURL(t *testing.T) {
+	u, err := InfluxConfig{URL: "http://influx:8086/", Database: "ops", RetentionPolicy: "week"}.writeURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://influx:8086/write?db=ops&precision=ns&rp=week", u)
+
+	u, err = InfluxConfig{URL: "http://influx:8086", Org: "emetriq", Bucket: "ops"}.writeURL()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://influx:8086/api/v2/write?bucket=ops&org=emetriq&precision=ns", u)
+
+	_, err = InfluxConfig{URL: "http://influx:8086", Bucket: "ops"}.writeURL()
+	assert.NotNil(t, err)
+	_, err = InfluxConfig{URL: "http://influx:8086"}.writeURL()
+	assert.NotNil(t, err)
+}
+
+func TestStartInfluxReporterV1(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/write", r.URL.Path)
+		assert.Equal(t, "ops", r.URL.Query().Get("db"))
+		user, pw, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "secret", pw)
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("hits", r).Inc(2)
+	reporter, err := StartInfluxReporter(InfluxConfig{URL: server.URL, Database: "ops", Username: "user", Password: "secret"}, "bidder",
+		WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.True(t, strings.HasPrefix(body, "hits,app=bidder,host="))
+	assert.Contains(t, body, " count=2,count_ps=")
+}
+
+func TestStartInfluxReporterV2RetriesWithGzip(t *testing.T) {
+	var calls int32
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "Token abc", r.Header.Get("Authorization"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		gz, err := gzip.NewReader(r.Body)
+		assert.Nil(t, err)
+		b, _ := ioutil.ReadAll(gz)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("temperature", r).Update(21)
+	reporter, err := StartInfluxReporter(InfluxConfig{URL: server.URL, Org: "emetriq", Bucket: "ops", Token: "abc", Gzip: true}, "bidder",
+		WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0), WithRetryBackoff(time.Millisecond, time.Millisecond))
+	assert.Nil(t, err)
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Contains(t, body, " value=21 ")
+}
+
+func TestInfluxWriteClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid field format"))
+	}))
+	defer server.Close()
+
+	writer := &influxWriter{writeURL: server.URL + "/write", client: &http.Client{}, batchSize: 10, minBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	err := writer.write(context.Background(), []string{"broken"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid field format")
+}
+
+func TestInfluxWriteContinuesAfterFailedBatch(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if strings.HasPrefix(string(body), "broken") {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	writer := &influxWriter{writeURL: server.URL + "/write", client: &http.Client{}, batchSize: 1, minBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	err := writer.write(context.Background(), []string{"broken", "a value=1", "b value=2"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "1 of 3 influx batches failed")
+	assert.Equal(t, []string{"broken\n", "a value=1\n", "b value=2\n"}, bodies)
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+)
+
+// logSummaryFields are the values of a metric which are part of the log summary
+var logSummaryFields = map[string]bool{
+	"count":      true,
+	"value":      true,
+	"min":        true,
+	"max":        true,
+	"mean":       true,
+	"one-minute": true,
+}
+
+// StartLogReporter starts a reporter which writes a compact summary of every metric of the default registry
+// through Logger every 10 seconds, e.g. for jobs without a metrics backend. It captures the runtime memory
+// stats every 5 seconds just like StartReporter. Timer durations are logged in milliseconds.
+// The env, app and host of the NamingPolicy are logged as tags of every metric.
+func StartLogReporter(opts ...ReporterOption) *Reporter {
+	cfg := newReporterConfig(opts)
+	naming := cfg.explicitNamingPolicy()
+	flush := func(ctx context.Context) error {
+		for _, line := range logSummaryLines(snapshotMetrics(cfg.registry, "", naming)) {
+			Logger.Info(line)
+		}
+		return nil
+	}
+	return startReporter(cfg, flush, nil)
+}
+
+// logSummaryLines formats every snapshot as a single line, e.g. "metric db.query count=3 max=12.5 mean=4.1 99-percentile=12.5"
+func logSummaryLines(snapshots []MetricSnapshot) []string {
+	lines := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		fields := make([]string, 0, len(snapshot.Values))
+		for field, value := range snapshot.Values {
+			if logSummaryFields[field] || strings.HasSuffix(field, "-percentile") {
+				fields = append(fields, field+"="+formatMetricValue(math.Round(value*1000)/1000))
+			}
+		}
+		sort.Strings(fields)
+		name := snapshot.Name
+		if len(snapshot.Tags) > 0 {
+			name = TaggedName(name, snapshot.Tags)
+		}
+		lines = append(lines, "metric "+name+" "+strings.Join(fields, " "))
+	}
+	return lines
+}
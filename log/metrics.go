@@ -0,0 +1,153 @@
+package log
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics creates and registers metrics in its registry.
+// The package level functions like GetCounter use DefaultMetrics.
+type Metrics struct {
+	registry  metrics.Registry
+	component string
+}
+
+// DefaultMetrics registers metrics in the metrics.DefaultRegistry
+var DefaultMetrics = NewMetrics(metrics.DefaultRegistry)
+
+// NewMetrics creates a Metrics for the given registry, if r is nil a new registry is created.
+func NewMetrics(r metrics.Registry) *Metrics {
+	if r == nil {
+		r = metrics.NewRegistry()
+	}
+	return &Metrics{registry: r}
+}
+
+// Registry returns the registry the metrics are registered in, e.g. to pass it to a reporter with WithRegistry
+func (m *Metrics) Registry() metrics.Registry {
+	return m.registry
+}
+
+// Child returns a Metrics for a component which registers all metrics with the prefix "<component>."
+// in the same registry, so they are reported together with the metrics of the parent.
+// The reporters place the component in the path according to the Layout of the NamingPolicy, so any
+// registry name starting with "<component>." is treated as a metric of the component.
+func (m *Metrics) Child(component string) *Metrics {
+	component = strings.TrimSuffix(component, ".")
+	fullComponent := component
+	if m.component != "" {
+		fullComponent = m.component + "." + component
+	}
+	registerComponent(fullComponent)
+	return &Metrics{registry: metrics.NewPrefixedChildRegistry(m.registry, component+"."), component: fullComponent}
+}
+
+// GetCounter creates a new counter or returns the existing counter with the given name.
+func (m *Metrics) GetCounter(metricName string) metrics.Counter {
+	return metrics.GetOrRegisterCounter(metricName, m.registry)
+}
+
+// GetHistogram creates a new histogram (or returns an existing one with the given name) with an exponential decay sample with default parameters.
+func (m *Metrics) GetHistogram(metricName string) metrics.Histogram {
+	return metrics.GetOrRegisterHistogram(metricName, m.registry, metrics.NewExpDecaySample(1028, 0.015))
+}
+
+// GetHistogramWithSample creates a new histogram with a sample of the given factory or returns the existing histogram with the given name.
+func (m *Metrics) GetHistogramWithSample(metricName string, newSample SampleFactory) metrics.Histogram {
+	return m.registry.GetOrRegister(metricName, func() metrics.Histogram {
+		return NewSampleHistogram(newSample())
+	}).(metrics.Histogram)
+}
+
+// GetMeter creates a new meter or returns the existing meter with the given name.
+func (m *Metrics) GetMeter(metricName string) metrics.Meter {
+	return metrics.GetOrRegisterMeter(metricName, m.registry)
+}
+
+// CreateGauge creates a new gauge that reports values returned by the given function.
+func (m *Metrics) CreateGauge(metricName string, value func() int64) {
+	gauge := metrics.NewFunctionalGauge(value)
+	m.registry.Register(metricName, gauge)
+}
+
+// GetGauge creates a new gauge or returns the existing gauge with the given name.
+func (m *Metrics) GetGauge(metricName string) metrics.Gauge {
+	return metrics.GetOrRegisterGauge(metricName, m.registry)
+}
+
+// GetGaugeFloat64 creates a new float gauge or returns the existing float gauge with the given name.
+func (m *Metrics) GetGaugeFloat64(metricName string) metrics.GaugeFloat64 {
+	return metrics.GetOrRegisterGaugeFloat64(metricName, m.registry)
+}
+
+// GetTimer creates a new timer or returns the existing timer with the given name.
+func (m *Metrics) GetTimer(metricName string) metrics.Timer {
+	return metrics.GetOrRegisterTimer(metricName, m.registry)
+}
+
+// GetTimerWithSample creates a new timer with a sample of the given factory or returns the existing timer with the given name.
+func (m *Metrics) GetTimerWithSample(metricName string, newSample SampleFactory) metrics.Timer {
+	return m.registry.GetOrRegister(metricName, func() metrics.Timer {
+		return NewSampleTimer(newSample())
+	}).(metrics.Timer)
+}
+
+// Time calls fn and records its duration in the timer with the given name.
+func (m *Metrics) Time(metricName string, fn func()) {
+	m.GetTimer(metricName).Time(fn)
+}
+
+// StartTimer starts a Stopwatch for the timer with the given name.
+func (m *Metrics) StartTimer(metricName string) *Stopwatch {
+	return &Stopwatch{timer: m.GetTimer(metricName), start: time.Now()}
+}
+
+// GetTaggedCounter creates a new counter or returns the existing counter with the given name and tags.
+func (m *Metrics) GetTaggedCounter(metricName string, tags map[string]string) metrics.Counter {
+	return m.GetCounter(TaggedName(metricName, tags))
+}
+
+// GetTaggedHistogram creates a new histogram or returns the existing histogram with the given name and tags.
+func (m *Metrics) GetTaggedHistogram(metricName string, tags map[string]string) metrics.Histogram {
+	return m.GetHistogram(TaggedName(metricName, tags))
+}
+
+// GetTaggedMeter creates a new meter or returns the existing meter with the given name and tags.
+func (m *Metrics) GetTaggedMeter(metricName string, tags map[string]string) metrics.Meter {
+	return m.GetMeter(TaggedName(metricName, tags))
+}
+
+// GetTaggedGauge creates a new gauge or returns the existing gauge with the given name and tags.
+func (m *Metrics) GetTaggedGauge(metricName string, tags map[string]string) metrics.Gauge {
+	return m.GetGauge(TaggedName(metricName, tags))
+}
+
+// GetTaggedTimer creates a new timer or returns the existing timer with the given name and tags.
+func (m *Metrics) GetTaggedTimer(metricName string, tags map[string]string) metrics.Timer {
+	return m.GetTimer(TaggedName(metricName, tags))
+}
+
+// CreateTopicMeterMap creates a map of Meters (topic -> Meter).
+func (m *Metrics) CreateTopicMeterMap(fmtString string, topics []string) map[string]metrics.Meter {
+	meterMap := map[string]metrics.Meter{}
+	for _, topic := range topics {
+		meterName := fmt.Sprintf(fmtString, topic)
+		Logger.Infof("created meter: %s", meterName)
+		meterMap[topic] = m.GetMeter(meterName)
+	}
+	return meterMap
+}
+
+// InstrumentHandler wraps next and records the requests of the given route, see the package level InstrumentHandler.
+func (m *Metrics) InstrumentHandler(route string, next http.Handler) http.Handler {
+	return instrumentHandler(m, route, next)
+}
+
+// InstrumentRoundTripper wraps next and records the outgoing requests per host, see the package level InstrumentRoundTripper.
+func (m *Metrics) InstrumentRoundTripper(next http.RoundTripper, opts ...RoundTripperOption) http.RoundTripper {
+	return newInstrumentedRoundTripper(m, next, opts)
+}
@@ -0,0 +1,46 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetricsIsolated(t *testing.T) {
+	m := NewMetrics(nil)
+	m.GetCounter("test.isolated").Inc(1)
+	assert.NotNil(t, m.Registry().Get("test.isolated"))
+	assert.Nil(t, metrics.DefaultRegistry.Get("test.isolated"))
+}
+
+func TestMetricsChild(t *testing.T) {
+	m := NewMetrics(nil)
+	kafka := m.Child("kafka")
+	kafka.GetMeter("consumed").Mark(1)
+	kafka.Child("orders.").GetTaggedCounter("errors", map[string]string{"env": "test"}).Inc(2)
+
+	assert.Equal(t, int64(1), m.GetMeter("kafka.consumed").Count())
+	assert.Equal(t, int64(2), m.GetCounter("kafka.orders.errors;env=test").Count())
+	assert.Equal(t, int64(2), kafka.GetCounter("orders.errors;env=test").Count())
+
+	names := []string{}
+	kafka.Registry().Each(func(name string, i interface{}) { names = append(names, name) })
+	assert.ElementsMatch(t, []string{"kafka.consumed", "kafka.orders.errors;env=test"}, names)
+}
+
+func TestMetricsCreateTopicMeterMap(t *testing.T) {
+	m := NewMetrics(nil)
+	meters := m.CreateTopicMeterMap("kafka.%s.consumed", []string{"a", "b"})
+	assert.Len(t, meters, 2)
+	assert.Equal(t, meters["a"], m.Registry().Get("kafka.a.consumed"))
+	assert.Len(t, MeterMapToSlice(meters), 2)
+}
+
+func TestMetricsGauges(t *testing.T) {
+	m := NewMetrics(nil)
+	m.CreateGauge("functional", func() int64 { return 42 })
+	m.GetGauge("plain").Update(7)
+	assert.Equal(t, int64(42), m.Registry().Get("functional").(metrics.Gauge).Value())
+	assert.Equal(t, int64(7), m.GetGauge("plain").Value())
+}
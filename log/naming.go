@@ -0,0 +1,239 @@
+package log
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Segment is a part of the metric path prefix
+type Segment int
+
+const (
+	// SegmentEnv is the environment, e.g. prod
+	SegmentEnv Segment = iota
+	// SegmentApp is the application name
+	SegmentApp
+	// SegmentHost is the host name
+	SegmentHost
+	// SegmentComponent is the component of Metrics.Child
+	SegmentComponent
+)
+
+// DefaultLayout is the order of the segments used if a NamingPolicy has no Layout
+var DefaultLayout = []Segment{SegmentEnv, SegmentApp, SegmentHost, SegmentComponent}
+
+// NamingPolicy defines the path of a metric as the env, app, host and component segments in the order of
+// the Layout followed by the metric name, e.g. <env>.<app>.<host>.<component>.<metric>. Empty segments are
+// skipped. The component is the one of the Metrics.Child the metric was registered with.
+// Every path based reporter builds its metric paths with Path, tag based backends like InfluxDB
+// report env, app and host as tags and keep the component in the metric name.
+type NamingPolicy struct {
+	Env  string
+	App  string
+	Host string
+	// Layout is the order of the segments, DefaultLayout if empty. Without SegmentComponent the component
+	// is placed right before the metric name.
+	Layout []Segment
+	// Sanitize replaces invalid characters of a single segment, SanitizeSegment if nil
+	Sanitize func(string) string
+}
+
+// globalNamingPolicy is the policy set with SetNamingPolicy
+var globalNamingPolicy *NamingPolicy
+
+// SetNamingPolicy sets the naming policy of all reporters without WithNamingPolicy and of PrometheusHandler,
+// WritePrometheus, MetricsHandler and SnapshotMetrics. Path based backends prefix the metrics with the
+// policy, tag based backends and the handlers add env, app and host as tags.
+// Without a policy the reporters keep the paths <GlobalMetricsPrefix>.<appName>.<metric> and all metric
+// names are reported as they are registered. Should be called on application init phase.
+func SetNamingPolicy(policy NamingPolicy) {
+	globalNamingPolicy = &policy
+}
+
+// WithNamingPolicy sets the naming policy of the reporter, it takes precedence over SetNamingPolicy.
+// If the app of the policy is empty, the app name of the reporter is used.
+func WithNamingPolicy(policy NamingPolicy) ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.naming = &policy
+	}
+}
+
+// NewNamingPolicy creates a policy for the given environment and app on this host with the DefaultLayout
+func NewNamingPolicy(env string, app string) NamingPolicy {
+	return NamingPolicy{Env: env, App: app, Host: GetHostname()}
+}
+
+// explicitNamingPolicy returns the policy of WithNamingPolicy or SetNamingPolicy, nil if none is set
+func (cfg reporterConfig) explicitNamingPolicy() *NamingPolicy {
+	if cfg.naming != nil {
+		return cfg.naming
+	}
+	return globalNamingPolicy
+}
+
+// namingPolicy returns the configured naming policy for the given app. Without a configured policy the
+// metric paths are <GlobalMetricsPrefix>.<appName>.<metric> with unchanged names.
+func (cfg reporterConfig) namingPolicy(appName string) NamingPolicy {
+	explicit := cfg.explicitNamingPolicy()
+	if explicit == nil {
+		return NamingPolicy{Env: GlobalMetricsPrefix, App: appName, Sanitize: keepSegment}
+	}
+	policy := *explicit
+	if policy.App == "" {
+		policy.App = appName
+	}
+	return policy
+}
+
+// keepSegment keeps a segment as it is
+func keepSegment(segment string) string {
+	return segment
+}
+
+func (p NamingPolicy) sanitize(segment string) string {
+	if p.Sanitize != nil {
+		return p.Sanitize(segment)
+	}
+	return SanitizeSegment(segment)
+}
+
+func (p NamingPolicy) segment(s Segment) string {
+	switch s {
+	case SegmentEnv:
+		return p.Env
+	case SegmentApp:
+		return p.App
+	case SegmentHost:
+		return p.Host
+	}
+	return ""
+}
+
+func (p NamingPolicy) layout() []Segment {
+	if len(p.Layout) == 0 {
+		return DefaultLayout
+	}
+	return p.Layout
+}
+
+// Prefix returns the sanitised env, app and host segments joined by dots
+func (p NamingPolicy) Prefix() string {
+	return p.Path("", "")
+}
+
+// Path returns the full path of a metric of a component in the order of the Layout
+func (p NamingPolicy) Path(component string, metric string) string {
+	parts := make([]string, 0, 5)
+	placed := false
+	for _, s := range p.layout() {
+		if s == SegmentComponent {
+			parts = append(parts, p.MetricName(component))
+			placed = true
+		} else if value := p.segment(s); value != "" {
+			parts = append(parts, p.sanitize(value))
+		}
+	}
+	if !placed {
+		parts = append(parts, p.MetricName(component))
+	}
+	parts = append(parts, p.MetricName(metric))
+
+	nonEmpty := parts[:0]
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ".")
+}
+
+// metricPath returns the full path of a registry name, the component of a Metrics.Child is split off the name
+func (p NamingPolicy) metricPath(registryName string) string {
+	component, metric := splitComponent(registryName)
+	return p.Path(component, metric)
+}
+
+// MetricName sanitises every dot separated segment of a registry name, tags are kept as they are
+func (p NamingPolicy) MetricName(taggedName string) string {
+	name, tags := splitTags(taggedName)
+	segments := strings.Split(name, ".")
+	for idx, segment := range segments {
+		segments[idx] = p.sanitize(segment)
+	}
+	return strings.Join(segments, ".") + tags
+}
+
+// Tags returns the non-empty env, app and host segments as tags
+func (p NamingPolicy) Tags() map[string]string {
+	tags := map[string]string{}
+	for key, value := range map[string]string{"env": p.Env, "app": p.App, "host": p.Host} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
+
+// SanitizeSegment replaces all characters except letters, digits, '_' and '-' with '_'
+func SanitizeSegment(segment string) string {
+	var sb strings.Builder
+	for _, c := range segment {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+// SanitizeMetricName sanitises every dot separated segment of a metric name with SanitizeSegment,
+// tags of a tagged name are kept as they are
+func SanitizeMetricName(taggedName string) string {
+	return NamingPolicy{}.MetricName(taggedName)
+}
+
+// splitTags splits a tagged name into the name and the raw tag suffix including the leading ';'
+func splitTags(taggedName string) (string, string) {
+	if idx := strings.Index(taggedName, ";"); idx >= 0 {
+		return taggedName[:idx], taggedName[idx:]
+	}
+	return taggedName, ""
+}
+
+// components holds the components of all Metrics.Child, so the reporters can place them in the layout
+var components = struct {
+	mu    sync.RWMutex
+	names []string
+}{}
+
+// registerComponent remembers the component of a Metrics.Child
+func registerComponent(component string) {
+	components.mu.Lock()
+	defer components.mu.Unlock()
+	idx := sort.SearchStrings(components.names, component)
+	if idx < len(components.names) && components.names[idx] == component {
+		return
+	}
+	components.names = append(components.names, "")
+	copy(components.names[idx+1:], components.names[idx:])
+	components.names[idx] = component
+}
+
+// splitComponent splits the longest registered component off a registry name
+func splitComponent(registryName string) (string, string) {
+	components.mu.RLock()
+	defer components.mu.RUnlock()
+	component := ""
+	for _, name := range components.names {
+		if len(name) > len(component) && strings.HasPrefix(registryName, name+".") {
+			component = name
+		}
+	}
+	if component == "" {
+		return "", registryName
+	}
+	return component, registryName[len(component)+1:]
+}
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamingPolicyPrefix(t *testing.T) {
+	policy := NamingPolicy{Env: "prod", App: "bid der", Host: "web1.example.com"}
+	assert.Equal(t, "prod.bid_der.web1_example_com", policy.Prefix())
+	policy.Layout = []Segment{SegmentHost, SegmentApp}
+	assert.Equal(t, "web1_example_com.bid_der", policy.Prefix())
+	assert.Equal(t, "api", NamingPolicy{App: "api"}.Prefix())
+	assert.Equal(t, "", NamingPolicy{}.Prefix())
+}
+
+func TestNamingPolicyPath(t *testing.T) {
+	policy := NamingPolicy{Env: "prod", App: "api", Host: "web1"}
+	assert.Equal(t, "prod.api.web1.kafka.consumer_lag", policy.Path("kafka", "consumer lag"))
+	assert.Equal(t, "prod.api.web1.requests;env=x", policy.Path("", "requests;env=x"))
+
+	policy.Layout = []Segment{SegmentEnv, SegmentComponent, SegmentApp}
+	assert.Equal(t, "prod.kafka.api.lag", policy.Path("kafka", "lag"))
+	assert.Equal(t, "prod.api", policy.Prefix(), "the prefix has no component")
+	policy.Layout = []Segment{SegmentHost, SegmentApp}
+	assert.Equal(t, "web1.api.kafka.lag", policy.Path("kafka", "lag"), "the component precedes the metric without SegmentComponent")
+
+	policy.Layout = nil
+	policy.Sanitize = strings.ToLower
+	assert.Equal(t, "prod.api.web1.kafka.lag", policy.Path("Kafka", "LAG"))
+}
+
+func TestNamingPolicyComponentOfChild(t *testing.T) {
+	m := NewMetrics(nil)
+	m.Child("billing").Child("kafka").GetCounter("lag").Inc(1)
+	m.GetCounter("requests").Inc(1)
+	policy := NamingPolicy{Env: "prod", App: "api", Host: "web1", Layout: []Segment{SegmentEnv, SegmentApp, SegmentComponent, SegmentHost}}
+	lines := graphiteLines(m.Registry(), policy, time.Second, TagsAsGraphiteTags, time.Unix(1, 0))
+	assert.Contains(t, lines, "prod.api.billing.kafka.web1.lag.count 1 1")
+	assert.Contains(t, lines, "prod.api.web1.requests.count 1 1")
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	assert.Equal(t, "http.server.requests;route=/a b", SanitizeMetricName("http.server.requests;route=/a b"))
+	assert.Equal(t, "a_b.c_d.e-f", SanitizeMetricName("a/b.c:d.e-f"))
+}
+
+func TestNamingPolicyTags(t *testing.T) {
+	assert.Equal(t, map[string]string{"app": "api", "host": "web1"}, NamingPolicy{App: "api", Host: "web1"}.Tags())
+}
+
+func TestMetricsKeepsNames(t *testing.T) {
+	m := NewMetrics(nil)
+	m.Child("kafka consumer").GetCounter("messages/s").Inc(1)
+	assert.IsType(t, metrics.NewCounter(), m.Registry().Get("kafka consumer.messages/s"))
+	assert.Contains(t, graphiteLines(m.Registry(), NamingPolicy{App: "app"}, time.Second, TagsAsGraphiteTags, time.Unix(1, 0)),
+		"app.kafka_consumer.messages_s.count 1 1")
+}
+
+func TestSetNamingPolicy(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("http requests;host=10.0.0.1", r).Inc(1)
+	SetNamingPolicy(NamingPolicy{Env: "prod", App: "api", Host: "web1"})
+	defer func() { globalNamingPolicy = nil }()
+
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r))
+	assert.Contains(t, buf.String(), "http_requests_total{host=\"10.0.0.1\",app=\"api\",env=\"prod\"} 1\n")
+
+	snapshots := SnapshotMetrics(r, "")
+	if assert.Len(t, snapshots, 1) {
+		assert.Equal(t, "http_requests", snapshots[0].Name)
+		assert.Equal(t, map[string]string{"env": "prod", "app": "api", "host": "10.0.0.1"}, snapshots[0].Tags)
+	}
+}
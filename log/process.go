@@ -0,0 +1,180 @@
+package log
+
+import (
+	"context"
+	"math"
+	"runtime"
+	runtimemetrics "runtime/metrics"
+	"time"
+)
+
+// ProcessMetricsComponent is the component under which CaptureProcessMetrics registers its metrics
+const ProcessMetricsComponent = "process"
+
+// defaultProcessMetricsInterval is the capture interval of CaptureProcessMetrics without a valid interval
+const defaultProcessMetricsInterval = 10 * time.Second
+
+const (
+	gcPausesMetric     = "/gc/pauses:seconds"
+	schedLatencyMetric = "/sched/latencies:seconds"
+)
+
+// procStats are the stats of the process read from /proc/self and the cgroup of the process.
+// Values which are not available on the platform are negative.
+type procStats struct {
+	cpuSeconds       float64
+	residentBytes    int64
+	openFDs          int64
+	throttledPeriods int64
+	throttledSeconds float64
+	memoryLimitBytes int64
+	memoryUsageBytes int64
+}
+
+// unavailableProcStats returns stats with all values marked as unavailable
+func unavailableProcStats() procStats {
+	return procStats{
+		cpuSeconds:       -1,
+		residentBytes:    -1,
+		openFDs:          -1,
+		throttledPeriods: -1,
+		throttledSeconds: -1,
+		memoryLimitBytes: -1,
+		memoryUsageBytes: -1,
+	}
+}
+
+// processCollector captures the Go runtime and process stats into gauges
+type processCollector struct {
+	metrics   *Metrics
+	readProc  func() procStats
+	samples   []runtimemetrics.Sample
+	lastHists map[string]*runtimemetrics.Float64Histogram
+}
+
+// CaptureProcessMetrics captures the goroutine count, GC pause and scheduler latency percentiles, CPU time,
+// resident memory, open file descriptors and cgroup CPU throttling and memory limits every interval
+// and registers them with the prefix "process." in the default registry. An interval <= 0 captures every 10s.
+// The /proc and cgroup stats are only available on linux. The returned func stops the capturing.
+func CaptureProcessMetrics(interval time.Duration) (stop func()) {
+	return DefaultMetrics.CaptureProcessMetrics(interval)
+}
+
+// CaptureProcessMetrics captures the process metrics into the registry of m, see the package level CaptureProcessMetrics.
+func (m *Metrics) CaptureProcessMetrics(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultProcessMetricsInterval
+	}
+	collector := newProcessCollector(m.Child(ProcessMetricsComponent), readProcStats)
+	collector.capture()
+	ctx, cancel := context.WithCancel(context.Background())
+	go runEvery(ctx, interval, collector.capture)
+	return cancel
+}
+
+func newProcessCollector(m *Metrics, readProc func() procStats) *processCollector {
+	return &processCollector{
+		metrics:  m,
+		readProc: readProc,
+		samples: []runtimemetrics.Sample{
+			{Name: gcPausesMetric},
+			{Name: schedLatencyMetric},
+		},
+		lastHists: map[string]*runtimemetrics.Float64Histogram{},
+	}
+}
+
+// capture updates all gauges once
+func (c *processCollector) capture() {
+	c.metrics.GetGauge("runtime.goroutines").Update(int64(runtime.NumGoroutine()))
+	c.metrics.GetGauge("runtime.threads").Update(int64(threadCount()))
+
+	runtimemetrics.Read(c.samples)
+	for _, sample := range c.samples {
+		if sample.Value.Kind() != runtimemetrics.KindFloat64Histogram {
+			continue
+		}
+		switch sample.Name {
+		case gcPausesMetric:
+			c.updatePercentiles("runtime.gc.pause_seconds", sample)
+		case schedLatencyMetric:
+			c.updatePercentiles("runtime.sched.latency_seconds", sample)
+		}
+	}
+
+	stats := c.readProc()
+	c.updateFloat("cpu_seconds", stats.cpuSeconds)
+	c.updateInt("resident_memory_bytes", stats.residentBytes)
+	c.updateInt("open_fds", stats.openFDs)
+	c.updateInt("cgroup.cpu.throttled_periods", stats.throttledPeriods)
+	c.updateFloat("cgroup.cpu.throttled_seconds", stats.throttledSeconds)
+	c.updateInt("cgroup.memory.limit_bytes", stats.memoryLimitBytes)
+	c.updateInt("cgroup.memory.usage_bytes", stats.memoryUsageBytes)
+}
+
+// updatePercentiles reports the ReportedPercentiles of the observations since the last capture.
+// The gauges keep their values if there were no new observations.
+func (c *processCollector) updatePercentiles(name string, sample runtimemetrics.Sample) {
+	hist := sample.Value.Float64Histogram()
+	counts := make([]uint64, len(hist.Counts))
+	copy(counts, hist.Counts)
+	if last, ok := c.lastHists[sample.Name]; ok && len(last.Counts) == len(counts) {
+		for idx := range counts {
+			counts[idx] -= last.Counts[idx]
+		}
+	}
+	c.lastHists[sample.Name] = &runtimemetrics.Float64Histogram{Counts: append([]uint64(nil), hist.Counts...), Buckets: hist.Buckets}
+
+	for _, p := range ReportedPercentiles {
+		if value, ok := histogramPercentile(counts, hist.Buckets, p); ok {
+			c.metrics.GetGaugeFloat64(name + "." + percentileField(p)).Update(value)
+		}
+	}
+}
+
+// histogramPercentile returns the upper bound of the bucket which contains the percentile p.
+// Buckets has one more element than counts, the bounds of the outer buckets may be infinite.
+func histogramPercentile(counts []uint64, buckets []float64, p float64) (float64, bool) {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(p * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	idx := 0
+	for ; idx < len(counts)-1; idx++ {
+		seen += counts[idx]
+		if seen >= rank {
+			break
+		}
+	}
+	if upper := buckets[idx+1]; !math.IsInf(upper, 1) {
+		return upper, true
+	}
+	// the last bucket is unbounded, report its lower bound
+	return buckets[idx], true
+}
+
+func (c *processCollector) updateInt(name string, value int64) {
+	if value >= 0 {
+		c.metrics.GetGauge(name).Update(value)
+	}
+}
+
+func (c *processCollector) updateFloat(name string, value float64) {
+	if value >= 0 {
+		c.metrics.GetGaugeFloat64(name).Update(value)
+	}
+}
+
+// threadCount returns the number of OS threads created by the runtime
+func threadCount() int {
+	n, _ := runtime.ThreadCreateProfile(nil)
+	return n
+}
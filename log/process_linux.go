@@ -0,0 +1,147 @@
+//go:build linux
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of the cpu times in /proc/self/stat, which is 100 on all supported architectures
+const clockTicks = 100
+
+func readProcStats() procStats {
+	return readProcStatsFrom("/proc/self", "/sys/fs/cgroup")
+}
+
+// cgroupDirs are the directories of the cgroups of a process
+type cgroupDirs struct {
+	unified string
+	cpu     string
+	memory  string
+}
+
+// resolveCgroupDirs resolves the cgroups of the process listed in <procDir>/cgroup below the cgroup mount point.
+// A cgroup which is not visible below the mount point, e.g. in a container without cgroup namespace,
+// falls back to the root of its hierarchy, which is the cgroup of the container then.
+func resolveCgroupDirs(procDir string, cgroupRoot string) cgroupDirs {
+	dirs := cgroupDirs{
+		unified: cgroupRoot,
+		cpu:     filepath.Join(cgroupRoot, "cpu"),
+		memory:  filepath.Join(cgroupRoot, "memory"),
+	}
+	data, err := os.ReadFile(filepath.Join(procDir, "cgroup"))
+	if err != nil {
+		return dirs
+	}
+	resolve := func(root string, path string) string {
+		dir := filepath.Join(root, path)
+		if _, err := os.Stat(dir); err != nil {
+			return root
+		}
+		return dir
+	}
+	// every line is hierarchy-ID:controller-list:cgroup-path, cgroup v2 has an empty controller list
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			dirs.unified = resolve(cgroupRoot, parts[2])
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			switch controller {
+			case "cpu":
+				dirs.cpu = resolve(filepath.Join(cgroupRoot, "cpu"), parts[2])
+			case "memory":
+				dirs.memory = resolve(filepath.Join(cgroupRoot, "memory"), parts[2])
+			}
+		}
+	}
+	return dirs
+}
+
+// readProcStatsFrom reads the process stats from the given proc directory of the process and its cgroups
+// below the cgroup mount point. It supports cgroup v2 and the cpu and memory controllers of cgroup v1.
+func readProcStatsFrom(procDir string, cgroupRoot string) procStats {
+	stats := unavailableProcStats()
+
+	if data, err := os.ReadFile(filepath.Join(procDir, "stat")); err == nil {
+		// the command in parentheses may contain spaces, the fields after it start with the state (field 3)
+		if idx := strings.LastIndexByte(string(data), ')'); idx >= 0 {
+			fields := strings.Fields(string(data)[idx+1:])
+			if len(fields) > 21 {
+				utime, _ := strconv.ParseFloat(fields[11], 64)
+				stime, _ := strconv.ParseFloat(fields[12], 64)
+				stats.cpuSeconds = (utime + stime) / clockTicks
+				if rss, err := strconv.ParseInt(fields[21], 10, 64); err == nil {
+					stats.residentBytes = rss * int64(os.Getpagesize())
+				}
+			}
+		}
+	}
+	if fds, err := os.ReadDir(filepath.Join(procDir, "fd")); err == nil {
+		stats.openFDs = int64(len(fds))
+	}
+
+	dirs := resolveCgroupDirs(procDir, cgroupRoot)
+	if cpuStat, err := readKeyValues(filepath.Join(dirs.unified, "cpu.stat")); err == nil {
+		// cgroup v2
+		if periods, ok := cpuStat["nr_throttled"]; ok {
+			stats.throttledPeriods = periods
+		}
+		if usec, ok := cpuStat["throttled_usec"]; ok {
+			stats.throttledSeconds = float64(usec) / 1e6
+		}
+		stats.memoryLimitBytes = readCgroupInt(filepath.Join(dirs.unified, "memory.max"))
+		stats.memoryUsageBytes = readCgroupInt(filepath.Join(dirs.unified, "memory.current"))
+	} else if cpuStat, err := readKeyValues(filepath.Join(dirs.cpu, "cpu.stat")); err == nil {
+		// cgroup v1
+		if periods, ok := cpuStat["nr_throttled"]; ok {
+			stats.throttledPeriods = periods
+		}
+		if nsec, ok := cpuStat["throttled_time"]; ok {
+			stats.throttledSeconds = float64(nsec) / 1e9
+		}
+		stats.memoryLimitBytes = readCgroupInt(filepath.Join(dirs.memory, "memory.limit_in_bytes"))
+		stats.memoryUsageBytes = readCgroupInt(filepath.Join(dirs.memory, "memory.usage_in_bytes"))
+	}
+	return stats
+}
+
+// readKeyValues reads a cgroup file with one "key value" pair per line
+func readKeyValues(path string) (map[string]int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]int64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, value, found := strings.Cut(line, " "); found {
+			if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				values[key] = n
+			}
+		}
+	}
+	return values, nil
+}
+
+// unlimitedMemory is the smallest value which cgroup v1 uses for an unlimited memory limit
+const unlimitedMemory = 1 << 62
+
+// readCgroupInt reads a single number from a cgroup file, -1 if it is missing or unlimited ("max")
+func readCgroupInt(path string) int64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || n >= unlimitedMemory {
+		return -1
+	}
+	return n
+}
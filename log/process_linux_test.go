@@ -0,0 +1,69 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestReadProcStatsCgroupV2(t *testing.T) {
+	proc, cgroup := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(proc, "stat"), "42 (my app) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 8 0 100 1000000 300 18446744073709551615")
+	writeTestFile(t, filepath.Join(proc, "fd", "0"), "")
+	writeTestFile(t, filepath.Join(proc, "fd", "1"), "")
+	writeTestFile(t, filepath.Join(cgroup, "cpu.stat"), "usage_usec 100\nnr_periods 10\nnr_throttled 3\nthrottled_usec 1500000\n")
+	writeTestFile(t, filepath.Join(cgroup, "memory.max"), "max\n")
+	writeTestFile(t, filepath.Join(cgroup, "memory.current"), "1048576\n")
+
+	stats := readProcStatsFrom(proc, cgroup)
+	assert.Equal(t, 3.0, stats.cpuSeconds)
+	assert.Equal(t, int64(300*os.Getpagesize()), stats.residentBytes)
+	assert.Equal(t, int64(2), stats.openFDs)
+	assert.Equal(t, int64(3), stats.throttledPeriods)
+	assert.Equal(t, 1.5, stats.throttledSeconds)
+	assert.Equal(t, int64(-1), stats.memoryLimitBytes)
+	assert.Equal(t, int64(1048576), stats.memoryUsageBytes)
+}
+
+func TestReadProcStatsCgroupV1(t *testing.T) {
+	cgroup := t.TempDir()
+	writeTestFile(t, filepath.Join(cgroup, "cpu", "cpu.stat"), "nr_periods 10\nnr_throttled 2\nthrottled_time 2000000000\n")
+	writeTestFile(t, filepath.Join(cgroup, "memory", "memory.limit_in_bytes"), "536870912\n")
+	writeTestFile(t, filepath.Join(cgroup, "memory", "memory.usage_in_bytes"), "1024\n")
+
+	stats := readProcStatsFrom(t.TempDir(), cgroup)
+	assert.Equal(t, -1.0, stats.cpuSeconds)
+	assert.Equal(t, int64(2), stats.throttledPeriods)
+	assert.Equal(t, 2.0, stats.throttledSeconds)
+	assert.Equal(t, int64(536870912), stats.memoryLimitBytes)
+	assert.Equal(t, int64(1024), stats.memoryUsageBytes)
+}
+
+func TestReadProcStatsResolvesCgroup(t *testing.T) {
+	proc, cgroup := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(proc, "cgroup"), "0::/system.slice/app.service\n")
+	writeTestFile(t, filepath.Join(cgroup, "cpu.stat"), "nr_throttled 9\n")
+	writeTestFile(t, filepath.Join(cgroup, "system.slice", "app.service", "cpu.stat"), "usage_usec 100\nthrottled_usec 500000\n")
+	writeTestFile(t, filepath.Join(cgroup, "system.slice", "app.service", "memory.max"), "4096\n")
+
+	stats := readProcStatsFrom(proc, cgroup)
+	assert.Equal(t, int64(-1), stats.throttledPeriods, "missing keys are not reported")
+	assert.Equal(t, 0.5, stats.throttledSeconds)
+	assert.Equal(t, int64(4096), stats.memoryLimitBytes)
+
+	// cgroup v1 in a container without cgroup namespace, the cgroup of the host is not mounted
+	writeTestFile(t, filepath.Join(proc, "cgroup"), "4:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n")
+	v1 := t.TempDir()
+	writeTestFile(t, filepath.Join(v1, "cpu", "cpu.stat"), "nr_throttled 2\n")
+	writeTestFile(t, filepath.Join(v1, "memory", "memory.limit_in_bytes"), "1024\n")
+	stats = readProcStatsFrom(proc, v1)
+	assert.Equal(t, int64(2), stats.throttledPeriods)
+	assert.Equal(t, int64(1024), stats.memoryLimitBytes)
+}
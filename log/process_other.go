@@ -0,0 +1,8 @@
+//go:build !linux
+
+package log
+
+// readProcStats is not supported outside of linux, all stats are unavailable
+func readProcStats() procStats {
+	return unavailableProcStats()
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	buckets := []float64{0, 1, 2, 4}
+	value, ok := histogramPercentile([]uint64{5, 4, 1}, buckets, 0.5)
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, value)
+	value, _ = histogramPercentile([]uint64{5, 4, 1}, buckets, 0.99)
+	assert.Equal(t, 4.0, value)
+	_, ok = histogramPercentile([]uint64{0, 0, 0}, buckets, 0.5)
+	assert.False(t, ok)
+
+	value, _ = histogramPercentile([]uint64{0, 1}, []float64{0, 1, math.Inf(1)}, 0.5)
+	assert.Equal(t, 1.0, value)
+}
+
+func TestProcessCollector(t *testing.T) {
+	m := NewMetrics(nil)
+	stats := unavailableProcStats()
+	stats.openFDs = 7
+	collector := newProcessCollector(m.Child(ProcessMetricsComponent), func() procStats { return stats })
+	runtime.GC()
+	collector.capture()
+
+	assert.Greater(t, m.Registry().Get("process.runtime.goroutines").(metrics.Gauge).Value(), int64(0))
+	assert.Equal(t, int64(7), m.Registry().Get("process.open_fds").(metrics.Gauge).Value())
+	assert.NotNil(t, m.Registry().Get("process.runtime.gc.pause_seconds.99-percentile"))
+	// unavailable stats are not registered
+	assert.Nil(t, m.Registry().Get("process.cgroup.memory.limit_bytes"))
+}
+
+func TestCaptureProcessMetricsStop(t *testing.T) {
+	m := NewMetrics(nil)
+	stop := m.CaptureProcessMetrics(time.Hour)
+	defer stop()
+	assert.NotNil(t, m.Registry().Get("process.runtime.goroutines"))
+
+	assert.NotPanics(t, func() { NewMetrics(nil).CaptureProcessMetrics(0)() })
+}
@@ -0,0 +1,302 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// prometheusContentType is the content type of the Prometheus text exposition format
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusLabelRule turns a variable part of a metric name into a label.
+// Format uses the same syntax as the fmtString of CreateTopicMeterMap, e.g. the rule
+// {Format: "kafka.%s.consumed", Label: "topic"} exposes the meter "kafka.orders.consumed"
+// as kafka_consumed_total{topic="orders"}.
+type PrometheusLabelRule struct {
+	Format string
+	Label  string
+}
+
+// match returns the metric name without the variable part and the label value
+func (rule PrometheusLabelRule) match(name string) (string, string, bool) {
+	prefix, suffix, found := strings.Cut(rule.Format, "%s")
+	if !found || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return "", "", false
+	}
+	if len(name) <= len(prefix)+len(suffix) {
+		return "", "", false
+	}
+	value := name[len(prefix) : len(name)-len(suffix)]
+	base := strings.Trim(strings.TrimSuffix(prefix, ".")+"."+strings.TrimPrefix(suffix, "."), ".")
+	return base, value, true
+}
+
+type prometheusLabel struct {
+	name  string
+	value string
+}
+
+type prometheusSample struct {
+	suffix   string
+	labels   []prometheusLabel
+	quantile string
+	value    float64
+}
+
+func (sample prometheusSample) labelString() string {
+	if sample.quantile == "" {
+		return prometheusLabelString(sample.labels)
+	}
+	return prometheusLabelString(append(append([]prometheusLabel{}, sample.labels...), prometheusLabel{name: "quantile", value: sample.quantile}))
+}
+
+type prometheusFamily struct {
+	name    string
+	kind    string
+	help    string
+	samples []prometheusSample
+	// sources maps the labels of every series to the go-metrics name it was created from
+	sources map[string]string
+}
+
+// loggedPrometheusCollisions holds the metrics which were skipped because of a name collision,
+// the warning is logged once per metric and not on every scrape
+var loggedPrometheusCollisions sync.Map
+
+// PrometheusHandler returns a http.Handler which renders all metrics of the given registry in the
+// Prometheus text format like WritePrometheus. If r is nil the metrics.DefaultRegistry is used.
+func PrometheusHandler(r metrics.Registry, rules ...PrometheusLabelRule) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		if err := WritePrometheus(w, r, rules...); err != nil {
+			Logger.Warnf("failed to write prometheus metrics: %v", err)
+		}
+	})
+}
+
+// WritePrometheus writes all metrics of the given registry in the Prometheus text format to w.
+// If r is nil the metrics.DefaultRegistry is used. The env, app and host of the policy of SetNamingPolicy
+// become labels.
+func WritePrometheus(w io.Writer, r metrics.Registry, rules ...PrometheusLabelRule) error {
+	return writePrometheus(w, r, globalNamingPolicy, rules)
+}
+
+// writePrometheus writes the registry with the metric names and labels of the naming policy, which may be nil
+func writePrometheus(w io.Writer, r metrics.Registry, naming *NamingPolicy, rules []PrometheusLabelRule) error {
+	if r == nil {
+		r = metrics.DefaultRegistry
+	}
+	quantiles := ReportedPercentiles
+	families := map[string]*prometheusFamily{}
+	var source string
+	add := func(name, kind, help string, sample prometheusSample) {
+		family, ok := families[name]
+		if !ok {
+			family = &prometheusFamily{name: name, kind: kind, help: help, sources: map[string]string{}}
+			families[name] = family
+		}
+		if family.kind != kind {
+			Logger.Debugf("skipping prometheus metric %s: type %s conflicts with %s", name, kind, family.kind)
+			return
+		}
+		series := prometheusLabelString(sample.labels)
+		if first, ok := family.sources[series]; ok && first != source {
+			if _, logged := loggedPrometheusCollisions.LoadOrStore(source, struct{}{}); !logged {
+				Logger.Warnf("skipping metric %s: it has the same prometheus name %s%s as %s", source, name, series, first)
+			}
+			return
+		}
+		family.sources[series] = source
+		family.samples = append(family.samples, sample)
+	}
+
+	// sorted names keep the choice between metrics with colliding prometheus names stable
+	registered := map[string]interface{}{}
+	r.Each(func(name string, i interface{}) {
+		registered[name] = i
+	})
+	sortedNames := make([]string, 0, len(registered))
+	for name := range registered {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	for _, name := range sortedNames {
+		i := registered[name]
+		source = name
+		base, labels := prometheusNameAndLabels(name, naming, rules)
+		switch metric := i.(type) {
+		case metrics.Counter:
+			add(base+"_total", "counter", name, prometheusSample{labels: labels, value: float64(metric.Count())})
+		case metrics.Gauge:
+			add(base, "gauge", name, prometheusSample{labels: labels, value: float64(metric.Value())})
+		case metrics.GaugeFloat64:
+			add(base, "gauge", name, prometheusSample{labels: labels, value: metric.Value()})
+		case metrics.Meter:
+			m := metric.Snapshot()
+			add(base+"_total", "counter", name, prometheusSample{labels: labels, value: float64(m.Count())})
+			add(base+"_rate1m", "gauge", name+" (one-minute rate)", prometheusSample{labels: labels, value: m.Rate1()})
+			add(base+"_rate5m", "gauge", name+" (five-minute rate)", prometheusSample{labels: labels, value: m.Rate5()})
+			add(base+"_rate15m", "gauge", name+" (fifteen-minute rate)", prometheusSample{labels: labels, value: m.Rate15()})
+			add(base+"_rate_mean", "gauge", name+" (mean rate)", prometheusSample{labels: labels, value: m.RateMean()})
+		case metrics.Histogram:
+			h := metric.Snapshot()
+			for _, sample := range prometheusSummary(labels, quantiles, h.Percentiles(quantiles), h.Count()) {
+				add(base, "summary", name, sample)
+			}
+			add(base+"_mean", "gauge", name+" (mean of the sample)", prometheusSample{labels: labels, value: h.Mean()})
+		case metrics.Timer:
+			t := metric.Snapshot()
+			ps := t.Percentiles(quantiles)
+			for idx := range ps {
+				ps[idx] /= float64(time.Second)
+			}
+			for _, sample := range prometheusSummary(labels, quantiles, ps, t.Count()) {
+				add(base+"_seconds", "summary", name, sample)
+			}
+			add(base+"_seconds_mean", "gauge", name+" (mean of the sample)", prometheusSample{labels: labels, value: t.Mean() / float64(time.Second)})
+		default:
+			Logger.Debugf("unable to expose metric %s of type %T", name, i)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		// keep the samples of a series together, summaries rely on the insertion order of their samples
+		sort.SliceStable(family.samples, func(a, b int) bool {
+			return prometheusLabelString(family.samples[a].labels) < prometheusLabelString(family.samples[b].labels)
+		})
+		fmt.Fprintf(bw, "# HELP %s %s\n", family.name, prometheusEscape(family.help, false))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", family.name, family.kind)
+		for _, sample := range family.samples {
+			fmt.Fprintf(bw, "%s%s%s %s\n", family.name, sample.suffix, sample.labelString(), prometheusFloat(sample.value))
+		}
+	}
+	return bw.Flush()
+}
+
+// prometheusSummary returns the quantiles and the count of a summary. There is no _sum: the sum of a go-metrics
+// sample only covers the values in its reservoir while the count covers all values, so rate(_sum)/rate(_count)
+// would be meaningless. The mean of the sample is exposed as a separate gauge instead.
+func prometheusSummary(labels []prometheusLabel, quantiles []float64, percentiles []float64, count int64) []prometheusSample {
+	samples := make([]prometheusSample, 0, len(percentiles)+1)
+	for idx, quantile := range quantiles {
+		samples = append(samples, prometheusSample{labels: labels, quantile: prometheusFloat(quantile), value: percentiles[idx]})
+	}
+	samples = append(samples, prometheusSample{suffix: "_count", labels: labels, value: float64(count)})
+	return samples
+}
+
+// prometheusNameAndLabels turns the tags of a tagged name and the tags of the naming policy into labels,
+// applies the first matching label rule and sanitises name and labels
+func prometheusNameAndLabels(taggedName string, naming *NamingPolicy, rules []PrometheusLabelRule) (string, []prometheusLabel) {
+	if naming != nil {
+		taggedName = naming.MetricName(taggedName)
+	}
+	name, tags := SplitTaggedName(taggedName)
+	labels := make([]prometheusLabel, 0, len(tags)+4)
+	for _, tag := range tags {
+		labels = append(labels, prometheusLabel{name: sanitizePrometheusLabelName(tag.Key), value: tag.Value})
+	}
+	if naming != nil {
+		labels = appendPolicyLabels(labels, naming.Tags())
+	}
+	for _, rule := range rules {
+		if base, value, ok := rule.match(name); ok {
+			labels = append(labels, prometheusLabel{name: sanitizePrometheusLabelName(rule.Label), value: value})
+			return SanitizePrometheusName(base), labels
+		}
+	}
+	return SanitizePrometheusName(name), labels
+}
+
+// appendPolicyLabels appends the tags of a naming policy sorted by key, the labels of the metric win
+func appendPolicyLabels(labels []prometheusLabel, tags map[string]string) []prometheusLabel {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		exists := false
+		for _, label := range labels {
+			exists = exists || label.name == key
+		}
+		if !exists {
+			labels = append(labels, prometheusLabel{name: key, value: tags[key]})
+		}
+	}
+	return labels
+}
+
+// SanitizePrometheusName converts a dotted go-metrics name into a valid Prometheus metric name
+func SanitizePrometheusName(name string) string {
+	return sanitizePrometheus(name, true)
+}
+
+func sanitizePrometheusLabelName(name string) string {
+	return sanitizePrometheus(name, false)
+}
+
+func sanitizePrometheus(name string, allowColon bool) string {
+	var sb strings.Builder
+	for idx, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+			sb.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if idx == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(c)
+		case c == ':' && allowColon:
+			sb.WriteRune(c)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	if sb.Len() == 0 {
+		return "_"
+	}
+	return sb.String()
+}
+
+func prometheusLabelString(labels []prometheusLabel) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts = append(parts, fmt.Sprintf("%s=\"%s\"", label.name, prometheusEscape(label.value, true)))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func prometheusEscape(value string, quotes bool) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	if quotes {
+		value = strings.ReplaceAll(value, `"`, `\"`)
+	}
+	return value
+}
+
+func prometheusFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
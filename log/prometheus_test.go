@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("requests.count", r).Inc(3)
+	metrics.GetOrRegisterGauge("queue-size", r).Update(7)
+	metrics.GetOrRegisterHistogram("latency", r, metrics.NewUniformSample(100)).Update(10)
+	metrics.GetOrRegisterTimer("db.query", r).Update(2 * time.Second)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r))
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE requests_count_total counter\nrequests_count_total 3\n")
+	assert.Contains(t, out, "# TYPE queue_size gauge\nqueue_size 7\n")
+	assert.Contains(t, out, "# TYPE latency summary\n")
+	assert.Contains(t, out, "latency{quantile=\"0.5\"} 10\n")
+	assert.Contains(t, out, "latency_count 1\n")
+	assert.NotContains(t, out, "latency_sum")
+	assert.Contains(t, out, "# TYPE latency_mean gauge\nlatency_mean 10\n")
+	assert.Contains(t, out, "db_query_seconds_mean 2\n")
+	assert.Contains(t, out, "db_query_seconds{quantile=\"0.99\"} 2\n")
+}
+
+func TestWritePrometheusLabelRule(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterMeter("kafka.orders.consumed", r).Mark(2)
+	metrics.GetOrRegisterMeter("kafka.my-topic.consumed", r).Mark(1)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r, PrometheusLabelRule{Format: "kafka.%s.consumed", Label: "topic"}))
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE kafka_consumed_total counter\nkafka_consumed_total{topic=\"my-topic\"} 1\nkafka_consumed_total{topic=\"orders\"} 2\n")
+	assert.Contains(t, out, "# TYPE kafka_consumed_rate1m gauge\n")
+}
+
+func TestWritePrometheusNameCollision(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("a.b", r).Inc(1)
+	metrics.GetOrRegisterCounter("a_b", r).Inc(2)
+	metrics.GetOrRegisterCounter("a-b;host=x", r).Inc(3)
+	metrics.GetOrRegisterCounter("a.b;host=x", r).Inc(4)
+
+	var logs bytes.Buffer
+	previous := Logger.Out
+	Logger.SetOutput(&logs)
+	defer Logger.SetOutput(previous)
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r))
+	assert.Nil(t, WritePrometheus(ioutil.Discard, r))
+	assert.Equal(t, 2, strings.Count(logs.String(), "skipping metric"), "the collision is logged once per metric")
+	assert.Equal(t, "# HELP a_b_total a-b;host=x\n# TYPE a_b_total counter\na_b_total 1\na_b_total{host=\"x\"} 3\n", buf.String())
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("hits", r).Inc(1)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(r).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, prometheusContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "hits_total 1\n")
+}
+
+func TestSanitizePrometheusName(t *testing.T) {
+	assert.Equal(t, "runtime_MemStats_Alloc", SanitizePrometheusName("runtime.MemStats.Alloc"))
+	assert.Equal(t, "_1xx_status", SanitizePrometheusName("1xx-status"))
+	assert.Equal(t, "app:requests", SanitizePrometheusName("app:requests"))
+}
@@ -0,0 +1,209 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reporterSet holds the running reporters which are flushed by PushMetricsNow
+type reporterSet struct {
+	mu        sync.Mutex
+	reporters map[*Reporter]struct{}
+}
+
+var activeReporters = &reporterSet{reporters: map[*Reporter]struct{}{}}
+
+func (s *reporterSet) add(r *Reporter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reporters[r] = struct{}{}
+}
+
+func (s *reporterSet) remove(r *Reporter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reporters, r)
+}
+
+func (s *reporterSet) list() []*Reporter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reporters := make([]*Reporter, 0, len(s.reporters))
+	for r := range s.reporters {
+		reporters = append(reporters, r)
+	}
+	return reporters
+}
+
+// PushMetricsNow synchronously flushes every running reporter, e.g. at the end of a batch job which finishes
+// before the first flush interval. The context limits how long the backends are retried.
+func PushMetricsNow(ctx context.Context) error {
+	reporters := activeReporters.list()
+	errs := make([]error, len(reporters))
+	var wg sync.WaitGroup
+	for idx, r := range reporters {
+		wg.Add(1)
+		go func(idx int, r *Reporter) {
+			defer wg.Done()
+			errs[idx] = r.Flush(ctx)
+		}(idx, r)
+	}
+	wg.Wait()
+
+	msgs := []string{}
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("failed to push metrics to %d of %d reporters: %s", len(msgs), len(reporters), strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// exitPush is a registration of PushMetricsOnExit
+type exitPush struct {
+	timeout time.Duration
+	signals bool
+}
+
+// ExitPushOption configures PushMetricsOnExit
+type ExitPushOption func(*exitPush)
+
+// WithoutSignals leaves SIGINT and SIGTERM to the signal handling of the application, the metrics are only
+// pushed when Logger.Fatal exits the process. Use it if the application handles the signals itself and call
+// PushMetricsNow from its shutdown path, so the application receives every signal exactly once.
+func WithoutSignals() ExitPushOption {
+	return func(registration *exitPush) {
+		registration.signals = false
+	}
+}
+
+var (
+	exitPushMu              sync.Mutex
+	exitPushes              = map[*exitPush]struct{}{}
+	registerExitHandlerOnce sync.Once
+	// exitSignals receives SIGINT and SIGTERM while a registration handles signals
+	exitSignals     chan os.Signal
+	stopExitSignals chan struct{}
+)
+
+// PushMetricsOnExit calls PushMetricsNow with the given timeout when the process receives SIGINT or SIGTERM
+// and when Logger.Fatal exits the process. A normal return from main is not covered, use
+//
+//	defer log.PushMetricsNow(ctx)
+//
+// for it. PushMetricsOnExit does not exit the process itself: after the push the signal is raised again with
+// its default action, which terminates the process. An application with its own handler for these signals
+// would receive them twice, it should use WithoutSignals and call PushMetricsNow from its shutdown path.
+// Several registrations push once with the longest timeout. The returned func removes the registration.
+func PushMetricsOnExit(timeout time.Duration, opts ...ExitPushOption) (cancel func()) {
+	registration := &exitPush{timeout: timeout, signals: true}
+	for _, opt := range opts {
+		opt(registration)
+	}
+	exitPushMu.Lock()
+	exitPushes[registration] = struct{}{}
+	if registration.signals && exitSignals == nil {
+		exitSignals = make(chan os.Signal, 1)
+		stopExitSignals = make(chan struct{})
+		signal.Notify(exitSignals, syscall.SIGINT, syscall.SIGTERM)
+		go handleExitSignals(exitSignals, stopExitSignals)
+	}
+	exitPushMu.Unlock()
+	registerExitHandlerOnce.Do(func() {
+		logrus.RegisterExitHandler(pushOnExit)
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			exitPushMu.Lock()
+			defer exitPushMu.Unlock()
+			delete(exitPushes, registration)
+			if exitSignals != nil && !signalRegistrations() {
+				signal.Stop(exitSignals)
+				close(stopExitSignals)
+				exitSignals, stopExitSignals = nil, nil
+			}
+		})
+	}
+}
+
+// signalRegistrations returns whether a registration handles signals, exitPushMu must be held
+func signalRegistrations() bool {
+	for registration := range exitPushes {
+		if registration.signals {
+			return true
+		}
+	}
+	return false
+}
+
+// handleExitSignals pushes the metrics once on the first signal and raises it again
+func handleExitSignals(signals chan os.Signal, stop chan struct{}) {
+	select {
+	case sig := <-signals:
+		exitPushMu.Lock()
+		signal.Stop(signals)
+		if exitSignals == signals {
+			exitSignals, stopExitSignals = nil, nil
+		}
+		exitPushMu.Unlock()
+		pushMetricsWithTimeout(longestExitTimeout(true))
+		raise(sig)
+	case <-stop:
+	}
+}
+
+// pushOnExit is the logrus exit handler which pushes the metrics if PushMetricsOnExit is registered
+func pushOnExit() {
+	exitPushMu.Lock()
+	registered := len(exitPushes) > 0
+	exitPushMu.Unlock()
+	if registered {
+		pushMetricsWithTimeout(longestExitTimeout(false))
+	}
+}
+
+// longestExitTimeout returns the longest timeout of the registrations, only of the ones handling signals
+// if signalsOnly is set
+func longestExitTimeout(signalsOnly bool) time.Duration {
+	exitPushMu.Lock()
+	defer exitPushMu.Unlock()
+	var timeout time.Duration
+	for registration := range exitPushes {
+		if (registration.signals || !signalsOnly) && registration.timeout > timeout {
+			timeout = registration.timeout
+		}
+	}
+	return timeout
+}
+
+func pushMetricsWithTimeout(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := PushMetricsNow(ctx); err != nil {
+		Logger.Warnf("failed to push metrics on exit: %v", err)
+	}
+}
+
+// raise sends the signal to the own process again, a variable so tests can replace it
+var raise = func(sig os.Signal) {
+	process, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = process.Signal(sig)
+	}
+	if err != nil {
+		Logger.Warnf("failed to raise %s after pushing metrics: %v", sig, err)
+	}
+}
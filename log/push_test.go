@@ -0,0 +1,192 @@
+package log
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+type pushgatewayStandIn struct {
+	mu       sync.Mutex
+	status   int
+	path     string
+	method   string
+	body     string
+	requests int
+}
+
+func (p *pushgatewayStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.path, p.method, p.body = r.URL.EscapedPath(), r.Method, string(body)
+	p.requests++
+	w.WriteHeader(p.status)
+}
+
+func TestPushMetricsNow(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("batch.rows", r).Inc(42)
+
+	graphite := newGraphiteStandIn(t)
+	graphiteReporter, err := StartReporter(graphite.Addr(), "job", WithRegistry(r), WithFlushInterval(time.Hour),
+		WithMemStatsInterval(0), WithNamingPolicy(NamingPolicy{}))
+	assert.Nil(t, err)
+	defer graphiteReporter.Stop(context.Background())
+
+	gateway := &pushgatewayStandIn{status: http.StatusOK}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	gatewayReporter, err := StartPushgatewayReporter(server.URL+"/", "nightly import", WithRegistry(r),
+		WithFlushInterval(time.Hour), WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	defer gatewayReporter.Stop(context.Background())
+
+	assert.Nil(t, PushMetricsNow(context.Background()))
+	assert.True(t, graphite.hasLine("job.batch.rows.count 42 "))
+	gateway.mu.Lock()
+	assert.Equal(t, http.MethodPut, gateway.method)
+	assert.Equal(t, "/metrics/job/nightly%20import/instance/"+url.PathEscape(GetHostname()), gateway.path)
+	assert.Contains(t, gateway.body, "batch_rows_total 42")
+	gateway.status = http.StatusBadRequest
+	gateway.mu.Unlock()
+
+	err = PushMetricsNow(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to push metrics to 1 of 2 reporters: pushgateway push failed with status 400")
+}
+
+func TestPushMetricsNowSkipsStoppedReporters(t *testing.T) {
+	gateway := &pushgatewayStandIn{status: http.StatusInternalServerError}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	reporter, err := StartPushgatewayReporter(server.URL, "job", WithRegistry(metrics.NewRegistry()),
+		WithFlushInterval(time.Hour), WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	assert.NotNil(t, reporter.Stop(context.Background()))
+	assert.Nil(t, PushMetricsNow(context.Background()))
+}
+
+func TestStartPushgatewayReporterInvalidConfig(t *testing.T) {
+	reporter, err := StartPushgatewayReporter("", "job")
+	assert.NotNil(t, err)
+	assert.Nil(t, reporter)
+}
+
+func TestPushMetricsOnExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can not be sent on windows")
+	}
+	raised := make(chan os.Signal, 2)
+	previousRaise := raise
+	raise = func(sig os.Signal) { raised <- sig }
+	defer func() { raise = previousRaise }()
+	// keeps the test process alive if the signal reaches the default action
+	appSignals := make(chan os.Signal, 2)
+	signal.Notify(appSignals, syscall.SIGTERM)
+	defer signal.Stop(appSignals)
+
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("batch.rows", r).Inc(7)
+	gateway := &pushgatewayStandIn{status: http.StatusOK}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	reporter, err := StartPushgatewayReporter(server.URL, "job", WithRegistry(r), WithFlushInterval(time.Hour),
+		WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	defer reporter.Stop(context.Background())
+
+	cancel := PushMetricsOnExit(time.Second)
+	defer cancel()
+	cancelOther := PushMetricsOnExit(time.Second)
+	defer cancelOther()
+	process, _ := os.FindProcess(os.Getpid())
+	assert.Nil(t, process.Signal(syscall.SIGTERM))
+	select {
+	case sig := <-raised:
+		assert.Equal(t, syscall.SIGTERM, sig)
+	case <-time.After(time.Second):
+		t.Fatal("the signal is not raised again after the push")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, raised, 0, "several registrations raise the signal once")
+	gateway.mu.Lock()
+	assert.Contains(t, gateway.body, "batch_rows_total 7")
+	assert.Equal(t, 1, gateway.requests, "several registrations push once")
+	gateway.mu.Unlock()
+}
+
+func TestPushMetricsOnExitWithoutSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can not be sent on windows")
+	}
+	appSignals := make(chan os.Signal, 2)
+	signal.Notify(appSignals, syscall.SIGTERM)
+	defer signal.Stop(appSignals)
+
+	gateway := &pushgatewayStandIn{status: http.StatusOK}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	reporter, err := StartPushgatewayReporter(server.URL, "job", WithRegistry(metrics.NewRegistry()),
+		WithFlushInterval(time.Hour), WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	defer reporter.Stop(context.Background())
+
+	cancel := PushMetricsOnExit(time.Second, WithoutSignals())
+	defer cancel()
+	process, _ := os.FindProcess(os.Getpid())
+	assert.Nil(t, process.Signal(syscall.SIGTERM))
+	select {
+	case <-appSignals:
+	case <-time.After(time.Second):
+		t.Fatal("the application does not receive the signal")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, appSignals, 0, "the application receives the signal once")
+	gateway.mu.Lock()
+	assert.Equal(t, 0, gateway.requests, "the application pushes from its own shutdown path")
+	gateway.mu.Unlock()
+
+	pushOnExit()
+	gateway.mu.Lock()
+	assert.Equal(t, 1, gateway.requests, "the exit handler of Logger.Fatal still pushes")
+	gateway.mu.Unlock()
+}
+
+func TestPushMetricsOnExitCancel(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("batch.rows", r).Inc(1)
+	gateway := &pushgatewayStandIn{status: http.StatusOK}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	reporter, err := StartPushgatewayReporter(server.URL, "job", WithRegistry(r), WithFlushInterval(time.Hour),
+		WithMemStatsInterval(0))
+	assert.Nil(t, err)
+	defer reporter.Stop(context.Background())
+
+	cancel := PushMetricsOnExit(time.Second)
+	pushOnExit()
+	gateway.mu.Lock()
+	assert.Contains(t, gateway.body, "batch_rows_total 1", "the exit handler of Logger.Fatal pushes")
+	gateway.body = ""
+	gateway.mu.Unlock()
+
+	cancel()
+	cancel()
+	pushOnExit()
+	gateway.mu.Lock()
+	assert.Empty(t, gateway.body, "the exit handler does nothing after cancel")
+	gateway.mu.Unlock()
+}
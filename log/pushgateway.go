@@ -0,0 +1,58 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithPrometheusLabelRules sets the rules which turn parts of the metric names into labels for the Pushgateway reporter
+func WithPrometheusLabelRules(rules ...PrometheusLabelRule) ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.prometheusRules = rules
+	}
+}
+
+// StartPushgatewayReporter starts a reporter which pushes the default registry in the Prometheus text format
+// to a Pushgateway compatible endpoint every 10 seconds and captures the runtime memory stats every 5 seconds,
+// just like StartReporter. The metrics are pushed with PUT to the group of the job and the hostname as instance,
+// so every push replaces the previous one. The env, app and host of the NamingPolicy become labels.
+func StartPushgatewayReporter(gatewayURL string, job string, opts ...ReporterOption) (*Reporter, error) {
+	if gatewayURL == "" || job == "" {
+		return nil, fmt.Errorf("pushgateway url and job must be set")
+	}
+	if _, err := url.Parse(gatewayURL); err != nil {
+		return nil, err
+	}
+	cfg := newReporterConfig(opts)
+	pushURL := fmt.Sprintf("%s/metrics/job/%s/instance/%s", strings.TrimSuffix(gatewayURL, "/"),
+		url.PathEscape(job), url.PathEscape(GetHostname()))
+	client := &http.Client{}
+	flush := func(ctx context.Context) error {
+		var body bytes.Buffer
+		if err := writePrometheus(&body, cfg.registry, cfg.explicitNamingPolicy(), cfg.prometheusRules); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, pushURL, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", prometheusContentType)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("pushgateway push failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	}
+	return startReporter(cfg, flush, nil), nil
+}
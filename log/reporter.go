@@ -0,0 +1,223 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ErrReporterStopped is returned when a stopped reporter is stopped or flushed again
+var ErrReporterStopped = errors.New("reporter already stopped")
+
+// ReporterOption configures a metrics reporter
+type ReporterOption func(*reporterConfig)
+
+type reporterConfig struct {
+	registry         metrics.Registry
+	flushInterval    time.Duration
+	memStatsInterval time.Duration
+	bufferSize       int
+	batchSize        int
+	minBackoff       time.Duration
+	maxBackoff       time.Duration
+	tagMode          TagMode
+	dogstatsd        bool
+	naming           *NamingPolicy
+	prometheusRules  []PrometheusLabelRule
+	graphiteProtocol GraphiteProtocol
+}
+
+func newReporterConfig(opts []ReporterOption) reporterConfig {
+	cfg := reporterConfig{
+		registry:         metrics.DefaultRegistry,
+		flushInterval:    10 * time.Second,
+		memStatsInterval: 5 * time.Second,
+		bufferSize:       100000,
+		batchSize:        500,
+		minBackoff:       100 * time.Millisecond,
+		maxBackoff:       5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithRegistry sets the registry which is reported (default metrics.DefaultRegistry)
+func WithRegistry(r metrics.Registry) ReporterOption {
+	return func(cfg *reporterConfig) {
+		if r != nil {
+			cfg.registry = r
+		}
+	}
+}
+
+// WithFlushInterval sets the interval in which the registry is sent to the backend (default 10s)
+func WithFlushInterval(d time.Duration) ReporterOption {
+	return func(cfg *reporterConfig) {
+		if d > 0 {
+			cfg.flushInterval = d
+		}
+	}
+}
+
+// WithMemStatsInterval sets the interval in which the runtime memory stats are captured (default 5s).
+// A value of 0 disables the capturing.
+func WithMemStatsInterval(d time.Duration) ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.memStatsInterval = d
+	}
+}
+
+// WithBufferSize sets the maximum number of data points buffered while the backend is unreachable (default 100000).
+// The oldest data points are dropped when the buffer is full.
+func WithBufferSize(n int) ReporterOption {
+	return func(cfg *reporterConfig) {
+		if n > 0 {
+			cfg.bufferSize = n
+		}
+	}
+}
+
+// WithBatchSize sets the maximum number of data points sent with a single write (default 500)
+func WithBatchSize(n int) ReporterOption {
+	return func(cfg *reporterConfig) {
+		if n > 0 {
+			cfg.batchSize = n
+		}
+	}
+}
+
+// WithRetryBackoff sets the bounds of the exponential backoff between failed sends (default 100ms to 5s)
+func WithRetryBackoff(min, max time.Duration) ReporterOption {
+	return func(cfg *reporterConfig) {
+		if min > 0 && max >= min {
+			cfg.minBackoff = min
+			cfg.maxBackoff = max
+		}
+	}
+}
+
+// Reporter periodically sends the metrics of a registry to a backend until it is stopped
+type Reporter struct {
+	flushFn  func(ctx context.Context) error
+	closeFn  func()
+	flushMu  sync.Mutex
+	closed   bool
+	stopped  int32
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startReporter runs flush every flush interval and captures the runtime memory stats if enabled.
+// closeFn is called after the final flush on Stop and may be nil.
+func startReporter(cfg reporterConfig, flush func(ctx context.Context) error, closeFn func()) *Reporter {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Reporter{
+		flushFn: flush,
+		closeFn: closeFn,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	activeReporters.add(r)
+
+	var wg sync.WaitGroup
+	if cfg.memStatsInterval > 0 {
+		metrics.RegisterRuntimeMemStats(cfg.registry)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runEvery(ctx, cfg.memStatsInterval, func() {
+				metrics.CaptureRuntimeMemStatsOnce(cfg.registry)
+			})
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runEvery(ctx, cfg.flushInterval, func() {
+			flushCtx, cancelFlush := context.WithTimeout(ctx, cfg.flushInterval)
+			defer cancelFlush()
+			if err := r.flush(flushCtx); err != nil {
+				Logger.Warnf("failed to report metrics: %v", err)
+			}
+		})
+	}()
+	go func() {
+		wg.Wait()
+		close(r.done)
+	}()
+	return r
+}
+
+// runEvery calls fn every interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
+
+// Flush sends the current state of the registry to the backend immediately.
+// It returns ErrReporterStopped once Stop has been called.
+func (r *Reporter) Flush(ctx context.Context) error {
+	if atomic.LoadInt32(&r.stopped) == 1 {
+		return ErrReporterStopped
+	}
+	return r.flush(ctx)
+}
+
+// flush sends the registry to the backend unless the backend is closed
+func (r *Reporter) flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	if r.closed {
+		return ErrReporterStopped
+	}
+	return r.flushFn(ctx)
+}
+
+// Stop stops the background goroutines of the reporter and performs a final flush.
+// The given context limits how long Stop waits for the goroutines and the final flush.
+func (r *Reporter) Stop(ctx context.Context) error {
+	err := ErrReporterStopped
+	r.stopOnce.Do(func() {
+		atomic.StoreInt32(&r.stopped, 1)
+		activeReporters.remove(r)
+		r.cancel()
+		select {
+		case <-r.done:
+			err = r.flush(ctx)
+			r.close()
+		case <-ctx.Done():
+			err = ctx.Err()
+			// the goroutines stop soon as they are canceled, the backend is closed once they are done
+			go func() {
+				<-r.done
+				r.close()
+			}()
+		}
+	})
+	return err
+}
+
+// close releases the backend of the reporter once no flush is running
+func (r *Reporter) close() {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	r.closed = true
+	if r.closeFn != nil {
+		r.closeFn()
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporterStopClosesAfterTimeout(t *testing.T) {
+	flushing := make(chan struct{})
+	release := make(chan struct{})
+	var closed int32
+	cfg := newReporterConfig([]ReporterOption{WithRegistry(metrics.NewRegistry()), WithFlushInterval(time.Millisecond),
+		WithMemStatsInterval(0)})
+	reporter := startReporter(cfg, func(ctx context.Context) error {
+		select {
+		case flushing <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}, func() { atomic.StoreInt32(&closed, 1) })
+
+	<-flushing
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, reporter.Stop(ctx))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&closed), "the backend is not closed during a flush")
+	close(release)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&closed) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestReporterFlushAfterStop(t *testing.T) {
+	var flushes, closed int32
+	cfg := newReporterConfig([]ReporterOption{WithRegistry(metrics.NewRegistry()), WithFlushInterval(time.Hour),
+		WithMemStatsInterval(0)})
+	reporter := startReporter(cfg, func(ctx context.Context) error {
+		atomic.AddInt32(&flushes, 1)
+		return nil
+	}, func() { atomic.StoreInt32(&closed, 1) })
+
+	assert.Nil(t, reporter.Flush(context.Background()))
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&flushes), "Stop flushes a last time")
+	assert.Equal(t, ErrReporterStopped, reporter.Flush(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&flushes), "a stopped reporter does not use its closed backend")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed))
+}
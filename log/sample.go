@@ -0,0 +1,571 @@
+package log
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// SampleFactory creates the sample (reservoir) of a new histogram or timer
+type SampleFactory func() metrics.Sample
+
+// ExpDecay returns a factory for the go-metrics exponentially-decaying sample,
+// GetHistogram uses ExpDecay(1028, 0.015).
+func ExpDecay(reservoirSize int, alpha float64) SampleFactory {
+	return func() metrics.Sample {
+		return metrics.NewExpDecaySample(reservoirSize, alpha)
+	}
+}
+
+// Uniform returns a factory for the go-metrics uniform sample which keeps a uniform random
+// selection of reservoirSize values of the whole lifetime
+func Uniform(reservoirSize int) SampleFactory {
+	return func() metrics.Sample {
+		return metrics.NewUniformSample(reservoirSize)
+	}
+}
+
+// SlidingWindow returns a factory for samples which keep all values of the last window, up to maxSize values
+// (default 1028)
+func SlidingWindow(window time.Duration, maxSize int) SampleFactory {
+	return func() metrics.Sample {
+		return NewSlidingWindowSample(window, maxSize)
+	}
+}
+
+// HighResolution returns a factory for HDR-histogram-style samples with the given relative error
+func HighResolution(relativeError float64) SampleFactory {
+	return func() metrics.Sample {
+		return NewHighResolutionSample(relativeError)
+	}
+}
+
+// GetHistogramWithSample creates a new histogram with a sample of the given factory or returns the
+// existing histogram with the given name from the default registry.
+func GetHistogramWithSample(metricName string, newSample SampleFactory) metrics.Histogram {
+	return DefaultMetrics.GetHistogramWithSample(metricName, newSample)
+}
+
+// GetTimerWithSample creates a new timer with a sample of the given factory or returns the
+// existing timer with the given name from the default registry.
+func GetTimerWithSample(metricName string, newSample SampleFactory) metrics.Timer {
+	return DefaultMetrics.GetTimerWithSample(metricName, newSample)
+}
+
+// defaultSlidingWindowSize is the maximum number of values of a sliding window without a valid maxSize,
+// it matches the reservoir size of GetHistogram
+const defaultSlidingWindowSize = 1028
+
+type timedValue struct {
+	timestamp time.Time
+	value     int64
+}
+
+// SlidingWindowSample keeps all values recorded within a time window, up to a maximum number of values.
+// Percentiles are exact for the values of the window.
+type SlidingWindowSample struct {
+	mu      sync.Mutex
+	window  time.Duration
+	maxSize int
+	count   int64
+	// values[start:] are the values of the window, the dropped values before start are removed in batches
+	values []timedValue
+	start  int
+	now    func() time.Time
+}
+
+// NewSlidingWindowSample creates a sample with all values of the last window, if more than maxSize
+// values are recorded within the window the oldest values are dropped. A maxSize <= 0 uses the default of 1028.
+func NewSlidingWindowSample(window time.Duration, maxSize int) *SlidingWindowSample {
+	if maxSize <= 0 {
+		maxSize = defaultSlidingWindowSize
+	}
+	return &SlidingWindowSample{window: window, maxSize: maxSize, now: time.Now}
+}
+
+// trim drops the values outside of the window, the caller must hold the lock
+func (s *SlidingWindowSample) trim() {
+	cutoff := s.now().Add(-s.window)
+	live := s.values[s.start:]
+	idx := sort.Search(len(live), func(i int) bool { return live[i].timestamp.After(cutoff) })
+	if overflow := len(live) - s.maxSize; overflow > idx {
+		idx = overflow
+	}
+	s.start += idx
+	// compact once the dropped values outnumber the live ones, so every value is moved at most once on average
+	if s.start > len(s.values)/2 {
+		n := copy(s.values, s.values[s.start:])
+		s.values = s.values[:n]
+		s.start = 0
+	}
+}
+
+// Clear clears all values
+func (s *SlidingWindowSample) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count = 0
+	s.values = nil
+	s.start = 0
+}
+
+// Count returns the number of values recorded since the sample was created or cleared, which may exceed Size
+func (s *SlidingWindowSample) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Max returns the maximum value of the window
+func (s *SlidingWindowSample) Max() int64 { return s.Snapshot().Max() }
+
+// Mean returns the mean of the values of the window
+func (s *SlidingWindowSample) Mean() float64 { return s.Snapshot().Mean() }
+
+// Min returns the minimum value of the window
+func (s *SlidingWindowSample) Min() int64 { return s.Snapshot().Min() }
+
+// Percentile returns an arbitrary percentile of the values of the window
+func (s *SlidingWindowSample) Percentile(p float64) float64 { return s.Snapshot().Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values of the window
+func (s *SlidingWindowSample) Percentiles(ps []float64) []float64 {
+	return s.Snapshot().Percentiles(ps)
+}
+
+// Size returns the number of values in the window
+func (s *SlidingWindowSample) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trim()
+	return len(s.values) - s.start
+}
+
+// Snapshot returns a read-only copy of the values of the window
+func (s *SlidingWindowSample) Snapshot() metrics.Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return metrics.NewSampleSnapshot(s.count, s.valuesLocked())
+}
+
+// StdDev returns the standard deviation of the values of the window
+func (s *SlidingWindowSample) StdDev() float64 { return s.Snapshot().StdDev() }
+
+// Sum returns the sum of the values of the window
+func (s *SlidingWindowSample) Sum() int64 { return s.Snapshot().Sum() }
+
+// Update records a new value
+func (s *SlidingWindowSample) Update(v int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.values = append(s.values, timedValue{timestamp: s.now(), value: v})
+	s.trim()
+}
+
+// Values returns a copy of the values of the window
+func (s *SlidingWindowSample) Values() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.valuesLocked()
+}
+
+func (s *SlidingWindowSample) valuesLocked() []int64 {
+	s.trim()
+	live := s.values[s.start:]
+	values := make([]int64, len(live))
+	for idx, v := range live {
+		values[idx] = v.value
+	}
+	return values
+}
+
+// Variance returns the variance of the values of the window
+func (s *SlidingWindowSample) Variance() float64 { return s.Snapshot().Variance() }
+
+// HighResolutionSample records every value in logarithmic buckets like an HDR histogram.
+// All values are kept, so percentiles cover the whole lifetime with a bounded relative error
+// instead of a random selection of values, at the cost of one counter per bucket.
+type HighResolutionSample struct {
+	mu            sync.Mutex
+	relativeError float64
+	logGamma      float64
+	positive      map[int]int64
+	negative      map[int]int64
+	zero          int64
+	count         int64
+	sum           int64
+	sumSquares    float64
+	min           int64
+	max           int64
+}
+
+// NewHighResolutionSample creates a sample whose percentiles deviate at most relativeError
+// (e.g. 0.01 for 1%) from the real value.
+func NewHighResolutionSample(relativeError float64) *HighResolutionSample {
+	if relativeError <= 0 || relativeError >= 1 {
+		relativeError = 0.01
+	}
+	gamma := (1 + relativeError) / (1 - relativeError)
+	return &HighResolutionSample{
+		relativeError: relativeError,
+		logGamma:      math.Log(gamma),
+		positive:      map[int]int64{},
+		negative:      map[int]int64{},
+	}
+}
+
+func (s *HighResolutionSample) bucket(v int64) int {
+	return int(math.Ceil(math.Log(float64(v)) / s.logGamma))
+}
+
+// bucketValue returns the value with the smallest relative error to all values of the bucket
+func (s *HighResolutionSample) bucketValue(idx int) float64 {
+	gamma := math.Exp(s.logGamma)
+	return 2 * math.Pow(gamma, float64(idx)) / (gamma + 1)
+}
+
+// Clear clears all values
+func (s *HighResolutionSample) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positive = map[int]int64{}
+	s.negative = map[int]int64{}
+	s.zero, s.count, s.sum, s.sumSquares, s.min, s.max = 0, 0, 0, 0, 0, 0
+}
+
+// Count returns the number of recorded values
+func (s *HighResolutionSample) Count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Max returns the exact maximum value
+func (s *HighResolutionSample) Max() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.max
+}
+
+// Mean returns the exact mean of all values
+func (s *HighResolutionSample) Mean() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	return float64(s.sum) / float64(s.count)
+}
+
+// Min returns the exact minimum value
+func (s *HighResolutionSample) Min() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.min
+}
+
+// Percentile returns an arbitrary percentile of all values
+func (s *HighResolutionSample) Percentile(p float64) float64 {
+	return s.Percentiles([]float64{p})[0]
+}
+
+// Percentiles returns a slice of arbitrary percentiles of all values
+func (s *HighResolutionSample) Percentiles(ps []float64) []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]float64, len(ps))
+	if s.count == 0 {
+		return result
+	}
+
+	buckets := s.sortedBuckets()
+	for i, p := range ps {
+		rank := int64(math.Ceil(p * float64(s.count)))
+		if rank < 1 {
+			rank = 1
+		}
+		var seen int64
+		for _, b := range buckets {
+			seen += b.count
+			if seen >= rank {
+				result[i] = math.Max(float64(s.min), math.Min(float64(s.max), b.value))
+				break
+			}
+		}
+	}
+	return result
+}
+
+type bucketCount struct {
+	value float64
+	count int64
+}
+
+// sortedBuckets returns the representative value and count of every non-empty bucket in ascending order,
+// the caller must hold the lock
+func (s *HighResolutionSample) sortedBuckets() []bucketCount {
+	buckets := make([]bucketCount, 0, len(s.negative)+len(s.positive)+1)
+	for idx, count := range s.negative {
+		buckets = append(buckets, bucketCount{-s.bucketValue(idx), count})
+	}
+	if s.zero > 0 {
+		buckets = append(buckets, bucketCount{0, s.zero})
+	}
+	for idx, count := range s.positive {
+		buckets = append(buckets, bucketCount{s.bucketValue(idx), count})
+	}
+	sort.Slice(buckets, func(a, b int) bool { return buckets[a].value < buckets[b].value })
+	return buckets
+}
+
+// Size returns the number of non-empty buckets
+func (s *HighResolutionSample) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size := len(s.positive) + len(s.negative)
+	if s.zero > 0 {
+		size++
+	}
+	return size
+}
+
+// Snapshot returns a read-only copy of the sample, whose percentiles, sum and mean are computed from the
+// buckets like the ones of the sample. Histograms and timers of go-metrics only support go-metrics sample
+// snapshots, use the sample with NewSampleHistogram, NewSampleTimer or GetHistogramWithSample instead.
+func (s *HighResolutionSample) Snapshot() metrics.Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := &HighResolutionSample{
+		relativeError: s.relativeError,
+		logGamma:      s.logGamma,
+		positive:      make(map[int]int64, len(s.positive)),
+		negative:      make(map[int]int64, len(s.negative)),
+		zero:          s.zero,
+		count:         s.count,
+		sum:           s.sum,
+		sumSquares:    s.sumSquares,
+		min:           s.min,
+		max:           s.max,
+	}
+	for idx, count := range s.positive {
+		snapshot.positive[idx] = count
+	}
+	for idx, count := range s.negative {
+		snapshot.negative[idx] = count
+	}
+	return highResolutionSnapshot{snapshot}
+}
+
+// StdDev returns the exact standard deviation of all values
+func (s *HighResolutionSample) StdDev() float64 {
+	return math.Sqrt(s.Variance())
+}
+
+// Sum returns the exact sum of all values
+func (s *HighResolutionSample) Sum() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sum
+}
+
+// Update records a new value
+func (s *HighResolutionSample) Update(v int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case v > 0:
+		s.positive[s.bucket(v)]++
+	case v < 0:
+		s.negative[s.bucket(-v)]++
+	default:
+		s.zero++
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+	s.sumSquares += float64(v) * float64(v)
+}
+
+// Values returns the representative value of every non-empty bucket
+func (s *HighResolutionSample) Values() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make([]int64, 0, len(s.positive)+len(s.negative)+1)
+	for idx := range s.negative {
+		values = append(values, -int64(math.Round(s.bucketValue(idx))))
+	}
+	if s.zero > 0 {
+		values = append(values, 0)
+	}
+	for idx := range s.positive {
+		values = append(values, int64(math.Round(s.bucketValue(idx))))
+	}
+	sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+	return values
+}
+
+// Variance returns the exact variance of all values
+func (s *HighResolutionSample) Variance() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == 0 {
+		return 0
+	}
+	mean := float64(s.sum) / float64(s.count)
+	return math.Max(0, s.sumSquares/float64(s.count)-mean*mean)
+}
+
+// highResolutionSnapshot is a read-only copy of a HighResolutionSample
+type highResolutionSnapshot struct {
+	*HighResolutionSample
+}
+
+// Clear panics
+func (highResolutionSnapshot) Clear() {
+	panic("Clear called on a HighResolutionSample snapshot")
+}
+
+// Snapshot returns the snapshot
+func (s highResolutionSnapshot) Snapshot() metrics.Sample { return s }
+
+// Update panics
+func (highResolutionSnapshot) Update(int64) {
+	panic("Update called on a HighResolutionSample snapshot")
+}
+
+// sampleHistogram is a histogram whose snapshot is based on any snapshot of its sample
+type sampleHistogram struct {
+	sample metrics.Sample
+}
+
+// NewSampleHistogram creates a histogram on the given sample. Unlike metrics.NewHistogram it supports samples
+// whose snapshots are not go-metrics sample snapshots, like HighResolutionSample.
+func NewSampleHistogram(s metrics.Sample) metrics.Histogram {
+	return &sampleHistogram{sample: s}
+}
+
+// Clear clears the sample
+func (h *sampleHistogram) Clear() { h.sample.Clear() }
+
+// Count returns the number of values recorded since the last Clear
+func (h *sampleHistogram) Count() int64 { return h.sample.Count() }
+
+// Max returns the maximum value of the sample
+func (h *sampleHistogram) Max() int64 { return h.sample.Max() }
+
+// Mean returns the mean of the values of the sample
+func (h *sampleHistogram) Mean() float64 { return h.sample.Mean() }
+
+// Min returns the minimum value of the sample
+func (h *sampleHistogram) Min() int64 { return h.sample.Min() }
+
+// Percentile returns an arbitrary percentile of the values of the sample
+func (h *sampleHistogram) Percentile(p float64) float64 { return h.sample.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the values of the sample
+func (h *sampleHistogram) Percentiles(ps []float64) []float64 { return h.sample.Percentiles(ps) }
+
+// Sample returns the sample of the histogram
+func (h *sampleHistogram) Sample() metrics.Sample { return h.sample }
+
+// Snapshot returns a read-only copy of the histogram
+func (h *sampleHistogram) Snapshot() metrics.Histogram {
+	return &sampleHistogram{sample: h.sample.Snapshot()}
+}
+
+// StdDev returns the standard deviation of the values of the sample
+func (h *sampleHistogram) StdDev() float64 { return h.sample.StdDev() }
+
+// Sum returns the sum of the values of the sample
+func (h *sampleHistogram) Sum() int64 { return h.sample.Sum() }
+
+// Update records a new value
+func (h *sampleHistogram) Update(v int64) { h.sample.Update(v) }
+
+// Variance returns the variance of the values of the sample
+func (h *sampleHistogram) Variance() float64 { return h.sample.Variance() }
+
+// sampleTimer is a timer whose durations are recorded by a sampleHistogram
+type sampleTimer struct {
+	histogram metrics.Histogram
+	meter     metrics.Meter
+}
+
+// NewSampleTimer creates a timer whose durations are recorded by the given sample.
+// Unlike metrics.NewCustomTimer it supports samples whose snapshots are not go-metrics sample snapshots,
+// like HighResolutionSample.
+func NewSampleTimer(s metrics.Sample) metrics.Timer {
+	return &sampleTimer{histogram: NewSampleHistogram(s), meter: metrics.NewMeter()}
+}
+
+// Count returns the number of recorded durations
+func (t *sampleTimer) Count() int64 { return t.histogram.Count() }
+
+// Max returns the maximum duration of the sample
+func (t *sampleTimer) Max() int64 { return t.histogram.Max() }
+
+// Mean returns the mean of the durations of the sample
+func (t *sampleTimer) Mean() float64 { return t.histogram.Mean() }
+
+// Min returns the minimum duration of the sample
+func (t *sampleTimer) Min() int64 { return t.histogram.Min() }
+
+// Percentile returns an arbitrary percentile of the durations of the sample
+func (t *sampleTimer) Percentile(p float64) float64 { return t.histogram.Percentile(p) }
+
+// Percentiles returns a slice of arbitrary percentiles of the durations of the sample
+func (t *sampleTimer) Percentiles(ps []float64) []float64 { return t.histogram.Percentiles(ps) }
+
+// Rate1 returns the one-minute moving average rate of events per second
+func (t *sampleTimer) Rate1() float64 { return t.meter.Rate1() }
+
+// Rate5 returns the five-minute moving average rate of events per second
+func (t *sampleTimer) Rate5() float64 { return t.meter.Rate5() }
+
+// Rate15 returns the fifteen-minute moving average rate of events per second
+func (t *sampleTimer) Rate15() float64 { return t.meter.Rate15() }
+
+// RateMean returns the mean rate of events per second
+func (t *sampleTimer) RateMean() float64 { return t.meter.RateMean() }
+
+// Snapshot returns a read-only copy of the timer
+func (t *sampleTimer) Snapshot() metrics.Timer {
+	return &sampleTimer{histogram: t.histogram.Snapshot(), meter: t.meter.Snapshot()}
+}
+
+// StdDev returns the standard deviation of the durations of the sample
+func (t *sampleTimer) StdDev() float64 { return t.histogram.StdDev() }
+
+// Stop stops the meter
+func (t *sampleTimer) Stop() { t.meter.Stop() }
+
+// Sum returns the sum of the durations of the sample
+func (t *sampleTimer) Sum() int64 { return t.histogram.Sum() }
+
+// Time records the duration of the execution of the given function
+func (t *sampleTimer) Time(f func()) {
+	start := time.Now()
+	f()
+	t.UpdateSince(start)
+}
+
+// Update records the duration of an event
+func (t *sampleTimer) Update(d time.Duration) {
+	t.histogram.Update(int64(d))
+	t.meter.Mark(1)
+}
+
+// UpdateSince records the duration of an event that started at ts and ends now
+func (t *sampleTimer) UpdateSince(ts time.Time) { t.Update(time.Since(ts)) }
+
+// Variance returns the variance of the durations of the sample
+func (t *sampleTimer) Variance() float64 { return t.histogram.Variance() }
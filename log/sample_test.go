@@ -0,0 +1,133 @@
+package log
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindowSample(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewSlidingWindowSample(time.Minute, 3)
+	s.now = func() time.Time { return now }
+
+	s.Update(1)
+	now = now.Add(30 * time.Second)
+	s.Update(2)
+	s.Update(3)
+	assert.Equal(t, []int64{1, 2, 3}, s.Values())
+
+	s.Update(4)
+	assert.Equal(t, []int64{2, 3, 4}, s.Values(), "oldest value dropped when maxSize is exceeded")
+
+	now = now.Add(61 * time.Second)
+	s.Update(5)
+	assert.Equal(t, []int64{5}, s.Values(), "values outside of the window dropped")
+	assert.Equal(t, int64(5), s.Count())
+	assert.Equal(t, int64(5), s.Max())
+
+	s = NewSlidingWindowSample(time.Minute, 0)
+	for v := int64(0); v < 2000; v++ {
+		s.Update(v)
+	}
+	assert.Equal(t, defaultSlidingWindowSize, s.Size(), "maxSize <= 0 uses the default")
+	assert.Equal(t, int64(1999), s.Max())
+}
+
+func TestHighResolutionSample(t *testing.T) {
+	s := NewHighResolutionSample(0.01)
+	for v := int64(1); v <= 100000; v++ {
+		s.Update(v)
+	}
+	ps := s.Percentiles([]float64{0.5, 0.9, 0.99, 0.999})
+	for idx, expected := range []float64{50000, 90000, 99000, 99900} {
+		assert.InDelta(t, expected, ps[idx], expected*0.01)
+	}
+	assert.Equal(t, int64(100000), s.Count())
+	assert.Equal(t, int64(1), s.Min())
+	assert.Equal(t, int64(100000), s.Max())
+	assert.Equal(t, 50000.5, s.Mean())
+	assert.InDelta(t, 28867.5, s.StdDev(), 1)
+
+	snapshot := s.Snapshot()
+	assert.Equal(t, int64(100000), snapshot.Count())
+	assert.Equal(t, int64(1), snapshot.Min())
+	assert.Equal(t, int64(100000), snapshot.Max())
+	assert.InDelta(t, 99000, snapshot.Percentile(0.99), 99000*0.02)
+}
+
+func TestHighResolutionSampleReported(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := NewSampleHistogram(NewHighResolutionSample(0.01))
+	r.Register("size", h)
+	timer := NewSampleTimer(NewHighResolutionSample(0.01))
+	r.Register("latency", timer)
+	h.Update(40)
+	timer.Update(2 * time.Second)
+
+	lines := graphiteLines(r, NamingPolicy{App: "app"}, time.Second, TagsAsGraphiteTags, time.Unix(1, 0))
+	assert.Contains(t, lines, "app.size.max 40 1")
+	assert.Contains(t, lines, "app.latency.count 1 1")
+
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r))
+	assert.Contains(t, buf.String(), "size{quantile=\"0.99\"} 40\n")
+	assert.Contains(t, buf.String(), "latency_seconds{quantile=\"0.5\"} 2\n")
+}
+
+func TestHighResolutionSampleSkewedSnapshot(t *testing.T) {
+	h := NewSampleHistogram(NewHighResolutionSample(0.01))
+	for i := 0; i < 990000; i++ {
+		h.Update(100)
+	}
+	for i := 0; i < 10000; i++ {
+		h.Update(100000)
+	}
+
+	snapshot := h.Snapshot()
+	h.Update(1)
+	assert.Equal(t, int64(1000000), snapshot.Count())
+	assert.Equal(t, int64(1099000000), snapshot.Sum())
+	assert.Equal(t, 1099.0, snapshot.Mean())
+	assert.Equal(t, int64(100000), snapshot.Max())
+	ps := snapshot.Percentiles([]float64{0.5, 0.99, 0.999})
+	assert.InDelta(t, 100, ps[0], 1)
+	assert.InDelta(t, 100, ps[1], 1, "the sparse tail does not shift the 99th percentile")
+	assert.InDelta(t, 100000, ps[2], 1000)
+	assert.Panics(t, func() { snapshot.Update(1) })
+}
+
+func TestHighResolutionSampleNegativeAndZero(t *testing.T) {
+	s := NewHighResolutionSample(0.01)
+	s.Update(-100)
+	s.Update(0)
+	s.Update(100)
+	assert.InDelta(t, -100, s.Percentile(0.1), 1)
+	assert.Equal(t, 0.0, s.Percentile(0.5))
+	assert.InDelta(t, 100, s.Percentile(1), 1)
+
+	snapshot := s.Snapshot()
+	s.Clear()
+	assert.Equal(t, int64(3), snapshot.Count())
+	assert.Equal(t, int64(0), s.Count())
+	assert.False(t, math.IsNaN(s.Percentile(0.5)))
+}
+
+func TestGetHistogramWithSample(t *testing.T) {
+	defer metrics.Unregister("test.highres")
+	h := GetHistogramWithSample("test.highres", HighResolution(0.01))
+	_, ok := h.Sample().(*HighResolutionSample)
+	assert.True(t, ok)
+	assert.Equal(t, h, GetHistogramWithSample("test.highres", Uniform(10)))
+}
+
+func TestGetTimerWithSample(t *testing.T) {
+	defer metrics.Unregister("test.window.timer")
+	timer := GetTimerWithSample("test.window.timer", SlidingWindow(time.Minute, 100))
+	timer.Update(time.Second)
+	assert.Equal(t, float64(time.Second), timer.Percentile(0.99))
+}
@@ -0,0 +1,212 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// udpMaxPacketSize keeps the udp packets below the common MTU
+const udpMaxPacketSize = 1432
+
+// dogstatsdTagReplacer replaces the characters which separate DogStatsD tags and their keys and values
+var dogstatsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", ":", "_", "\n", "_")
+
+// WithDogStatsd reports tags in the DogStatsD format (name:1|c|#key:value) instead of flattening them into the path
+func WithDogStatsd() ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.dogstatsd = true
+	}
+}
+
+// StatsdClient sends metrics to a StatsD agent over udp.
+// It is safe for concurrent use.
+type StatsdClient struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+	mu        sync.Mutex
+}
+
+// NewStatsdClient creates a client for the StatsD agent at addr which prepends prefix to all metric names.
+// If dogstatsd is true tags are sent in the DogStatsD format, otherwise they are flattened into the path.
+func NewStatsdClient(addr string, prefix string, dogstatsd bool) (*StatsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdClient{conn: conn, prefix: prefix, dogstatsd: dogstatsd}, nil
+}
+
+// Count sends a counter increment
+func (c *StatsdClient) Count(name string, value int64, tags map[string]string) error {
+	return c.send([]string{c.line(SanitizeMetricName(TaggedName(name, tags)), "", fmt.Sprint(value), "c")})
+}
+
+// Gauge sends the current value of a gauge
+func (c *StatsdClient) Gauge(name string, value float64, tags map[string]string) error {
+	return c.send(c.gaugeLines(SanitizeMetricName(TaggedName(name, tags)), "", value))
+}
+
+// Timing sends a duration in milliseconds
+func (c *StatsdClient) Timing(name string, d time.Duration, tags map[string]string) error {
+	return c.send([]string{c.line(SanitizeMetricName(TaggedName(name, tags)), "", formatMetricValue(float64(d)/float64(time.Millisecond)), "ms")})
+}
+
+// Close closes the udp connection
+func (c *StatsdClient) Close() error {
+	return c.conn.Close()
+}
+
+// line formats a single statsd line for the tagged metric name
+func (c *StatsdClient) line(taggedName string, field string, value string, kind string) string {
+	if !c.dogstatsd {
+		return fmt.Sprintf("%s:%s|%s", taggedPath(c.prefix, taggedName, field, TagsInPath), value, kind)
+	}
+	name, tags := SplitTaggedName(taggedName)
+	line := fmt.Sprintf("%s:%s|%s", taggedPath(c.prefix, name, field, TagsInPath), value, kind)
+	if len(tags) > 0 {
+		pairs := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			pairs = append(pairs, dogstatsdTagReplacer.Replace(tag.Key)+":"+dogstatsdTagReplacer.Replace(tag.Value))
+		}
+		line += "|#" + strings.Join(pairs, ",")
+	}
+	return line
+}
+
+// gaugeLines formats a gauge, negative values have to be reset to 0 first because statsd treats them as decrement
+func (c *StatsdClient) gaugeLines(taggedName string, field string, value float64) []string {
+	line := c.line(taggedName, field, formatMetricValue(value), "g")
+	if value < 0 {
+		return []string{c.line(taggedName, field, "0", "g"), line}
+	}
+	return []string{line}
+}
+
+// send packs the lines into as few udp packets as possible
+func (c *StatsdClient) send(lines []string) error {
+	_, err := c.sendContext(context.Background(), lines)
+	return err
+}
+
+// sendContext sends the lines until ctx is done and returns the number of lines which have been written
+func (c *StatsdClient) sendContext(ctx context.Context, lines []string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	sent := 0
+	for _, packet := range packLines(lines, udpMaxPacketSize) {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		if _, err := c.conn.Write(packet); err != nil {
+			return sent, err
+		}
+		sent += bytes.Count(packet, []byte("\n")) + 1
+	}
+	return sent, nil
+}
+
+// packLines joins the lines with newlines into packets of at most maxSize bytes, longer lines get a packet of their own
+func packLines(lines []string, maxSize int) [][]byte {
+	packets := [][]byte{}
+	var packet strings.Builder
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxSize {
+			packets = append(packets, []byte(packet.String()))
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteString("\n")
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		packets = append(packets, []byte(packet.String()))
+	}
+	return packets
+}
+
+// StartStatsdReporter starts a reporter which sends the default registry every 10 seconds to the StatsD agent
+// at statsdAddr and captures the runtime memory stats every 5 seconds, the metric paths follow the NamingPolicy
+// just like the ones of StartReporter.
+// Counters and meters are sent as counter increments since the last flush, gauges as gauges and the
+// statistics of histograms and timers as gauges, timer durations in milliseconds.
+func StartStatsdReporter(statsdAddr string, appName string, opts ...ReporterOption) (*Reporter, error) {
+	cfg := newReporterConfig(opts)
+	naming := cfg.namingPolicy(appName)
+	client, err := NewStatsdClient(statsdAddr, "", cfg.dogstatsd)
+	if err != nil {
+		return nil, err
+	}
+	lastCounts := map[string]int64{}
+	flush := func(ctx context.Context) error {
+		return statsdFlush(ctx, client, cfg.registry, naming, lastCounts)
+	}
+	return startReporter(cfg, flush, func() { client.Close() }), nil
+}
+
+// statsdCount is the count of a counter line which becomes the base of the next delta once the line is sent
+type statsdCount struct {
+	line  int
+	name  string
+	count int64
+}
+
+// statsdFlush sends all metrics of the registry, lastCounts keeps the counts which have been sent so far
+func statsdFlush(ctx context.Context, c *StatsdClient, r metrics.Registry, naming NamingPolicy, lastCounts map[string]int64) error {
+	lines, counts := statsdLines(c, r, naming, lastCounts)
+	sent, err := c.sendContext(ctx, lines)
+	for _, count := range counts {
+		if count.line < sent {
+			lastCounts[count.name] = count.count
+		}
+	}
+	return err
+}
+
+// statsdLines renders all metrics of the registry, lastCounts keeps the counts of the previous flush
+func statsdLines(c *StatsdClient, r metrics.Registry, naming NamingPolicy, lastCounts map[string]int64) ([]string, []statsdCount) {
+	lines := []string{}
+	counts := []statsdCount{}
+	delta := func(name string, count int64) string {
+		counts = append(counts, statsdCount{line: len(lines), name: name, count: count})
+		return fmt.Sprint(count - lastCounts[name])
+	}
+	r.Each(func(registryName string, i interface{}) {
+		name := naming.metricPath(registryName)
+		switch metric := i.(type) {
+		case metrics.Counter:
+			lines = append(lines, c.line(name, "", delta(name, metric.Count()), "c"))
+		case metrics.Meter:
+			lines = append(lines, c.line(name, "", delta(name, metric.Count()), "c"))
+		case metrics.Gauge:
+			lines = append(lines, c.gaugeLines(name, "", float64(metric.Value()))...)
+		case metrics.GaugeFloat64:
+			lines = append(lines, c.gaugeLines(name, "", metric.Value())...)
+		case metrics.Histogram, metrics.Timer:
+			values, _ := metricValues(i, ReportedPercentiles, time.Second, time.Millisecond)
+			for _, v := range values {
+				switch v.field {
+				case "count":
+					lines = append(lines, c.line(name, v.field, delta(name, int64(v.value)), "c"))
+				case "count_ps", "one-minute", "five-minute", "fifteen-minute", "mean-rate":
+					// statsd derives rates from the counter itself
+				default:
+					lines = append(lines, c.gaugeLines(name, v.field, v.value)...)
+				}
+			}
+		default:
+			Logger.Debugf("unable to report metric %s of type %T", name, i)
+		}
+	})
+	return lines, counts
+}
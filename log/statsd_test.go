@@ -0,0 +1,93 @@
+package log
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// listenStatsd starts a local udp listener and returns its address and a function reading the next packet
+func listenStatsd(t *testing.T) (string, func() []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	read := func() []string {
+		buf := make([]byte, udpMaxPacketSize)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		return strings.Split(string(buf[:n]), "\n")
+	}
+	return conn.LocalAddr().String(), read
+}
+
+func TestStatsdClient(t *testing.T) {
+	addr, read := listenStatsd(t)
+	client, err := NewStatsdClient(addr, "app", false)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	assert.Nil(t, client.Count("requests", 2, map[string]string{"env": "prod"}))
+	assert.Equal(t, []string{"app.requests.env.prod:2|c"}, read())
+	assert.Nil(t, client.Timing("latency", 1500*time.Microsecond, nil))
+	assert.Equal(t, []string{"app.latency:1.5|ms"}, read())
+	assert.Nil(t, client.Gauge("temperature", -3, nil))
+	assert.Equal(t, []string{"app.temperature:0|g", "app.temperature:-3|g"}, read())
+}
+
+func TestDogStatsdClient(t *testing.T) {
+	addr, read := listenStatsd(t)
+	client, err := NewStatsdClient(addr, "app", true)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	assert.Nil(t, client.Count("requests", 1, map[string]string{"env": "prod", "host": "x"}))
+	assert.Equal(t, []string{"app.requests:1|c|#env:prod,host:x"}, read())
+	assert.Nil(t, client.Count("requests", 1, map[string]string{"host": "127.0.0.1:80", "tags": "a,b|c"}))
+	assert.Equal(t, []string{"app.requests:1|c|#host:127.0.0.1_80,tags:a_b_c"}, read())
+}
+
+func TestStatsdFlushKeepsCountsOfFailedSends(t *testing.T) {
+	addr, read := listenStatsd(t)
+	client, err := NewStatsdClient(addr, "app", false)
+	assert.Nil(t, err)
+	defer client.Close()
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("hits", r).Inc(3)
+	lastCounts := map[string]int64{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, statsdFlush(ctx, client, r, NamingPolicy{}, lastCounts))
+	assert.Empty(t, lastCounts)
+
+	assert.Nil(t, statsdFlush(context.Background(), client, r, NamingPolicy{}, lastCounts))
+	assert.Equal(t, []string{"app.hits:3|c"}, read())
+	assert.Equal(t, map[string]int64{"hits": 3}, lastCounts)
+}
+
+func TestStartStatsdReporter(t *testing.T) {
+	addr, read := listenStatsd(t)
+	r := metrics.NewRegistry()
+	counter := metrics.GetOrRegisterCounter("hits", r)
+	counter.Inc(3)
+	metrics.GetOrRegisterTimer("db", r).Update(2 * time.Millisecond)
+
+	reporter, err := StartStatsdReporter(addr, "app", WithRegistry(r), WithFlushInterval(time.Hour), WithMemStatsInterval(0),
+		WithNamingPolicy(NamingPolicy{}))
+	assert.Nil(t, err)
+	assert.Nil(t, reporter.Flush(context.Background()))
+	lines := read()
+	assert.Contains(t, lines, "app.hits:3|c")
+	assert.Contains(t, lines, "app.db.count:1|c")
+	assert.Contains(t, lines, "app.db.99-percentile:2|g")
+
+	counter.Inc(2)
+	assert.Nil(t, reporter.Stop(context.Background()))
+	assert.Contains(t, read(), "app.hits:2|c")
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// TagMode defines how the tags of a tagged metric are reported
+type TagMode int
+
+const (
+	// TagsAsGraphiteTags reports tags as graphite 1.1 tags, e.g. name;env=prod;host=x
+	TagsAsGraphiteTags TagMode = iota
+	// TagsInPath flattens tags into the metric path for older graphite versions, e.g. name.env.prod.host.x
+	TagsInPath
+)
+
+// Tag is a single key value pair of a tagged metric name
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// WithTagMode sets how the reporter emits tagged metrics (default TagsAsGraphiteTags)
+func WithTagMode(mode TagMode) ReporterOption {
+	return func(cfg *reporterConfig) {
+		cfg.tagMode = mode
+	}
+}
+
+// TaggedName encodes a metric name and its tags in the graphite tag format name;key1=value1;key2=value2.
+// The tags are sorted by key, so the same tags always result in the same registry entry.
+func TaggedName(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, key := range keys {
+		sb.WriteString(";")
+		sb.WriteString(sanitizeTag(key))
+		sb.WriteString("=")
+		sb.WriteString(strings.TrimLeft(sanitizeTag(tags[key]), "~"))
+	}
+	return sb.String()
+}
+
+// SplitTaggedName splits a name created by TaggedName into the metric name and its tags
+func SplitTaggedName(taggedName string) (string, []Tag) {
+	parts := strings.Split(taggedName, ";")
+	if len(parts) == 1 {
+		return taggedName, nil
+	}
+	tags := make([]Tag, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		if key, value, found := strings.Cut(part, "="); found {
+			tags = append(tags, Tag{Key: key, Value: value})
+		}
+	}
+	return parts[0], tags
+}
+
+var (
+	tagReplacer = strings.NewReplacer(";", "_", "=", "_", " ", "_", "!", "_", "^", "_")
+	// graphiteTagReplacer additionally replaces the characters which break graphite paths and statsd lines
+	graphiteTagReplacer = strings.NewReplacer(";", "_", "=", "_", " ", "_", "!", "_", "^", "_", "/", "_", ":", "_")
+)
+
+// sanitizeTag replaces the characters which separate tags in a tagged name
+func sanitizeTag(s string) string {
+	return tagReplacer.Replace(s)
+}
+
+// sanitizeGraphiteTag replaces the characters which are not allowed in graphite tag keys and values
+func sanitizeGraphiteTag(s string) string {
+	return graphiteTagReplacer.Replace(s)
+}
+
+// taggedPath formats a metric path with the field in the given tag mode
+func taggedPath(prefix string, taggedName string, field string, mode TagMode) string {
+	name, tags := SplitTaggedName(taggedName)
+	path := name
+	if prefix != "" {
+		path = prefix + "." + name
+	}
+	if mode == TagsInPath {
+		for _, tag := range tags {
+			path += "." + SanitizeSegment(tag.Key) + "." + SanitizeSegment(tag.Value)
+		}
+	}
+	if field != "" {
+		path += "." + field
+	}
+	if mode == TagsAsGraphiteTags {
+		for _, tag := range tags {
+			path += ";" + sanitizeGraphiteTag(tag.Key) + "=" + sanitizeGraphiteTag(tag.Value)
+		}
+	}
+	return path
+}
+
+// GetTaggedCounter creates a new counter or returns the existing counter with the given name and tags from the default registry.
+func GetTaggedCounter(metricName string, tags map[string]string) metrics.Counter {
+	return DefaultMetrics.GetTaggedCounter(metricName, tags)
+}
+
+// GetTaggedHistogram creates a new histogram or returns the existing histogram with the given name and tags from the default registry.
+func GetTaggedHistogram(metricName string, tags map[string]string) metrics.Histogram {
+	return DefaultMetrics.GetTaggedHistogram(metricName, tags)
+}
+
+// GetTaggedMeter creates a new meter or returns the existing meter with the given name and tags from the default registry.
+func GetTaggedMeter(metricName string, tags map[string]string) metrics.Meter {
+	return DefaultMetrics.GetTaggedMeter(metricName, tags)
+}
+
+// GetTaggedGauge creates a new gauge or returns the existing gauge with the given name and tags from the default registry.
+func GetTaggedGauge(metricName string, tags map[string]string) metrics.Gauge {
+	return DefaultMetrics.GetTaggedGauge(metricName, tags)
+}
+
+// GetTaggedTimer creates a new timer or returns the existing timer with the given name and tags from the default registry.
+func GetTaggedTimer(metricName string, tags map[string]string) metrics.Timer {
+	return DefaultMetrics.GetTaggedTimer(metricName, tags)
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaggedName(t *testing.T) {
+	assert.Equal(t, "requests", TaggedName("requests", nil))
+	assert.Equal(t, "requests;env=prod;host=web_1", TaggedName("requests", map[string]string{"host": "web 1", "env": "prod"}))
+	assert.Equal(t, "requests;path=x", TaggedName("requests", map[string]string{"path": "~x"}))
+}
+
+func TestSplitTaggedName(t *testing.T) {
+	name, tags := SplitTaggedName("requests;env=prod;host=x")
+	assert.Equal(t, "requests", name)
+	assert.Equal(t, []Tag{{"env", "prod"}, {"host", "x"}}, tags)
+
+	name, tags = SplitTaggedName("requests")
+	assert.Equal(t, "requests", name)
+	assert.Nil(t, tags)
+}
+
+func TestTaggedPath(t *testing.T) {
+	assert.Equal(t, "app.requests.count;env=prod", taggedPath("app", "requests;env=prod", "count", TagsAsGraphiteTags))
+	assert.Equal(t, "app.requests.env.prod.host.a_b.count", taggedPath("app", "requests;env=prod;host=a.b", "count", TagsInPath))
+	assert.Equal(t, "requests.count", taggedPath("", "requests", "count", TagsInPath))
+	assert.Equal(t, "requests.host.127_0_0_1_80.route._users__id_.count",
+		taggedPath("", "requests;host=127.0.0.1:80;route=/users/{id}", "count", TagsInPath))
+	assert.Equal(t, "requests.count;host=127.0.0.1_80;route=_users_{id}",
+		taggedPath("", "requests;host=127.0.0.1:80;route=/users/{id}", "count", TagsAsGraphiteTags))
+}
+
+func TestGetTaggedCounter(t *testing.T) {
+	counter := GetTaggedCounter("test.tagged", map[string]string{"env": "test"})
+	defer metrics.Unregister("test.tagged;env=test")
+	counter.Inc(1)
+	assert.Equal(t, counter, metrics.Get("test.tagged;env=test"))
+}
+
+func TestTaggedGraphiteLines(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(TaggedName("hits", map[string]string{"env": "prod"}), r).Inc(1)
+	assert.Contains(t, graphiteLines(r, NamingPolicy{App: "app"}, time.Second, TagsAsGraphiteTags, time.Unix(1, 0)), "app.hits.count;env=prod 1 1")
+	assert.Contains(t, graphiteLines(r, NamingPolicy{App: "app"}, time.Second, TagsInPath, time.Unix(1, 0)), "app.hits.env.prod.count 1 1")
+}
+
+func TestTaggedPrometheusLabels(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter(TaggedName("hits", map[string]string{"env": "prod"}), r).Inc(1)
+	var buf bytes.Buffer
+	assert.Nil(t, WritePrometheus(&buf, r))
+	assert.Contains(t, buf.String(), "hits_total{env=\"prod\"} 1\n")
+}
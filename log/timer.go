@@ -0,0 +1,37 @@
+package log
+
+import (
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// GetTimer creates a new timer or returns the existing timer with the given name from the default registry.
+func GetTimer(metricName string) metrics.Timer {
+	return DefaultMetrics.GetTimer(metricName)
+}
+
+// Time calls fn and records its duration in the timer with the given name.
+func Time(metricName string, fn func()) {
+	DefaultMetrics.Time(metricName, fn)
+}
+
+// Stopwatch records the time from its start until Stop is called in a timer
+type Stopwatch struct {
+	timer metrics.Timer
+	start time.Time
+}
+
+// StartTimer starts a Stopwatch for the timer with the given name, e.g.
+//
+//	defer log.StartTimer("db.query").Stop()
+func StartTimer(metricName string) *Stopwatch {
+	return DefaultMetrics.StartTimer(metricName)
+}
+
+// Stop records and returns the elapsed time since the start
+func (s *Stopwatch) Stop() time.Duration {
+	elapsed := time.Since(s.start)
+	s.timer.Update(elapsed)
+	return elapsed
+}
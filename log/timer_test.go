@@ -0,0 +1,27 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTime(t *testing.T) {
+	defer metrics.Unregister("test.time")
+	called := false
+	Time("test.time", func() { called = true })
+	assert.True(t, called)
+	assert.Equal(t, int64(1), GetTimer("test.time").Count())
+}
+
+func TestStartTimer(t *testing.T) {
+	defer metrics.Unregister("test.stopwatch")
+	stopwatch := StartTimer("test.stopwatch")
+	time.Sleep(time.Millisecond)
+	elapsed := stopwatch.Stop()
+	assert.True(t, elapsed >= time.Millisecond)
+	assert.Equal(t, int64(1), GetTimer("test.stopwatch").Count())
+	assert.Equal(t, int64(elapsed), GetTimer("test.stopwatch").Max())
+}
@@ -0,0 +1,94 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// metricValue is a single reported value of a metric, e.g. the one-minute rate of a meter
+type metricValue struct {
+	field string
+	value float64
+}
+
+// metricValues flattens a metric into the values reported to the backends.
+// The field names follow the layout of the go-metrics graphite reporter, timer durations are reported in durationUnit.
+func metricValues(i interface{}, percentiles []float64, flushInterval time.Duration, durationUnit time.Duration) ([]metricValue, bool) {
+	flushSeconds := flushInterval.Seconds()
+	du := float64(durationUnit)
+	switch metric := i.(type) {
+	case metrics.Counter:
+		count := metric.Count()
+		return []metricValue{
+			{"count", float64(count)},
+			{"count_ps", float64(count) / flushSeconds},
+		}, true
+	case metrics.Gauge:
+		return []metricValue{{"value", float64(metric.Value())}}, true
+	case metrics.GaugeFloat64:
+		return []metricValue{{"value", metric.Value()}}, true
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		values := []metricValue{
+			{"count", float64(h.Count())},
+			{"min", float64(h.Min())},
+			{"max", float64(h.Max())},
+			{"mean", h.Mean()},
+			{"std-dev", h.StdDev()},
+		}
+		return append(values, percentileValues(percentiles, h.Percentiles(percentiles))...), true
+	case metrics.Meter:
+		m := metric.Snapshot()
+		return []metricValue{
+			{"count", float64(m.Count())},
+			{"one-minute", m.Rate1()},
+			{"five-minute", m.Rate5()},
+			{"fifteen-minute", m.Rate15()},
+			{"mean", m.RateMean()},
+		}, true
+	case metrics.Timer:
+		t := metric.Snapshot()
+		count := t.Count()
+		values := []metricValue{
+			{"count", float64(count)},
+			{"count_ps", float64(count) / flushSeconds},
+			{"min", float64(t.Min()) / du},
+			{"max", float64(t.Max()) / du},
+			{"mean", t.Mean() / du},
+			{"std-dev", t.StdDev() / du},
+		}
+		ps := t.Percentiles(percentiles)
+		for idx := range ps {
+			ps[idx] /= du
+		}
+		values = append(values, percentileValues(percentiles, ps)...)
+		return append(values,
+			metricValue{"one-minute", t.Rate1()},
+			metricValue{"five-minute", t.Rate5()},
+			metricValue{"fifteen-minute", t.Rate15()},
+			metricValue{"mean-rate", t.RateMean()},
+		), true
+	}
+	return nil, false
+}
+
+func percentileValues(percentiles []float64, values []float64) []metricValue {
+	result := make([]metricValue, 0, len(percentiles))
+	for idx, p := range percentiles {
+		result = append(result, metricValue{percentileField(p), values[idx]})
+	}
+	return result
+}
+
+// percentileField returns the field name of a percentile, e.g. 99-percentile for 0.99 and 999-percentile for 0.999
+func percentileField(p float64) string {
+	return strings.Replace(strconv.FormatFloat(p*100.0, 'f', -1, 64), ".", "", 1) + "-percentile"
+}
+
+// formatMetricValue formats a value without exponent and without trailing zeros
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,255 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// OverflowLabelValue is the label value of the series which collects all label values beyond the max cardinality
+const OverflowLabelValue = "other"
+
+// VecOption configures a labeled metric family
+type VecOption func(*vecConfig)
+
+type vecConfig struct {
+	maxCardinality int
+	idleExpiry     time.Duration
+}
+
+// WithMaxCardinality limits the number of series of label values of a family (default 1000).
+// Further label values are folded into a series with all labels set to OverflowLabelValue, which comes on top
+// of the limit, so a family has at most n+1 series.
+func WithMaxCardinality(n int) VecOption {
+	return func(cfg *vecConfig) {
+		if n > 0 {
+			cfg.maxCardinality = n
+		}
+	}
+}
+
+// WithIdleExpiry unregisters series which have not been updated for the given duration (default 0, never).
+// Idle series are expired when the family is used or ExpireIdle is called.
+// An expired metric is detached from the registry and an expired meter is stopped, so updates of a metric which was
+// returned by With or WithLabelValues before are lost. With an idle expiry callers must not keep the returned
+// metrics but call With or WithLabelValues for every update.
+func WithIdleExpiry(d time.Duration) VecOption {
+	return func(cfg *vecConfig) {
+		cfg.idleExpiry = d
+	}
+}
+
+// vecChild is a single series of a family
+type vecChild[T any] struct {
+	metric     T
+	lastCount  int64
+	lastUpdate time.Time
+}
+
+// metricVec creates the series of a family on demand as tagged metrics of the registry.
+// The series are keyed by their registry name, so label values which result in the same tagged name
+// share one series.
+type metricVec[T any] struct {
+	metrics    *Metrics
+	name       string
+	labelNames []string
+	cfg        vecConfig
+	register   func(name string) T
+	count      func(metric T) int64
+	now        func() time.Time
+
+	mu         sync.Mutex
+	children   map[string]*vecChild[T]
+	overflowed bool
+	lastSweep  time.Time
+}
+
+func newMetricVec[T any](m *Metrics, name string, labelNames []string, opts []VecOption,
+	register func(name string) T, count func(metric T) int64) *metricVec[T] {
+	cfg := vecConfig{maxCardinality: 1000}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &metricVec[T]{
+		metrics:    m,
+		name:       name,
+		labelNames: labelNames,
+		cfg:        cfg,
+		register:   register,
+		count:      count,
+		now:        time.Now,
+		children:   map[string]*vecChild[T]{},
+	}
+}
+
+// withLabels returns the series of the label values in the order of the label names, missing labels are empty
+func (v *metricVec[T]) withLabels(labels map[string]string) T {
+	values := make([]string, len(v.labelNames))
+	for idx, labelName := range v.labelNames {
+		values[idx] = labels[labelName]
+	}
+	return v.withValues(values)
+}
+
+// withValues returns the series of the label values and creates it if necessary
+func (v *metricVec[T]) withValues(values []string) T {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values but got %d", v.name, len(v.labelNames), len(values)))
+	}
+	name := v.seriesName(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	if v.cfg.idleExpiry > 0 && now.Sub(v.lastSweep) >= v.cfg.idleExpiry/2 {
+		v.expireIdle(now)
+	}
+	if child, ok := v.children[name]; ok {
+		return child.metric
+	}
+	if len(v.children) >= v.cfg.maxCardinality {
+		if !v.overflowed {
+			Logger.Warnf("metric %s exceeded its max cardinality of %d, folding new label values into %q",
+				v.name, v.cfg.maxCardinality, OverflowLabelValue)
+			v.overflowed = true
+		}
+		values = make([]string, len(v.labelNames))
+		for idx := range values {
+			values[idx] = OverflowLabelValue
+		}
+		name = v.seriesName(values)
+		if child, ok := v.children[name]; ok {
+			return child.metric
+		}
+	}
+
+	metric := v.register(name)
+	v.children[name] = &vecChild[T]{metric: metric, lastCount: v.count(metric), lastUpdate: now}
+	return metric
+}
+
+// seriesName returns the tagged registry name of the label values
+func (v *metricVec[T]) seriesName(values []string) string {
+	tags := make(map[string]string, len(v.labelNames))
+	for idx, labelName := range v.labelNames {
+		tags[labelName] = values[idx]
+	}
+	return TaggedName(v.name, tags)
+}
+
+// expireIdle unregisters all series whose count has not changed within the idle expiry.
+// Updates are detected by comparing the counts between sweeps, so the idle time of a series starts
+// at the sweep which observed its last update.
+func (v *metricVec[T]) expireIdle(now time.Time) int {
+	v.lastSweep = now
+	expired := 0
+	for name, child := range v.children {
+		if count := v.count(child.metric); count != child.lastCount {
+			child.lastCount = count
+			child.lastUpdate = now
+			continue
+		}
+		if now.Sub(child.lastUpdate) >= v.cfg.idleExpiry {
+			v.metrics.registry.Unregister(name)
+			delete(v.children, name)
+			expired++
+		}
+	}
+	return expired
+}
+
+// ExpireIdle unregisters the idle series now and returns their number, it does nothing without WithIdleExpiry
+func (v *metricVec[T]) ExpireIdle() int {
+	if v.cfg.idleExpiry <= 0 {
+		return 0
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.expireIdle(v.now())
+}
+
+// CounterVec is a family of counters which are partitioned by label values
+type CounterVec struct {
+	*metricVec[metrics.Counter]
+}
+
+// With returns the counter of the given labels, labels which are not set are empty.
+// Do not keep the counter if the family has an idle expiry, see WithIdleExpiry.
+func (v *CounterVec) With(labels map[string]string) metrics.Counter {
+	return v.withLabels(labels)
+}
+
+// WithLabelValues returns the counter of the label values in the order of the label names of the family
+func (v *CounterVec) WithLabelValues(values ...string) metrics.Counter {
+	return v.withValues(values)
+}
+
+// MeterVec is a family of meters which are partitioned by label values
+type MeterVec struct {
+	*metricVec[metrics.Meter]
+}
+
+// With returns the meter of the given labels, labels which are not set are empty.
+// Do not keep the meter if the family has an idle expiry, see WithIdleExpiry.
+func (v *MeterVec) With(labels map[string]string) metrics.Meter {
+	return v.withLabels(labels)
+}
+
+// WithLabelValues returns the meter of the label values in the order of the label names of the family
+func (v *MeterVec) WithLabelValues(values ...string) metrics.Meter {
+	return v.withValues(values)
+}
+
+// HistogramVec is a family of histograms which are partitioned by label values
+type HistogramVec struct {
+	*metricVec[metrics.Histogram]
+}
+
+// With returns the histogram of the given labels, labels which are not set are empty.
+// Do not keep the histogram if the family has an idle expiry, see WithIdleExpiry.
+func (v *HistogramVec) With(labels map[string]string) metrics.Histogram {
+	return v.withLabels(labels)
+}
+
+// WithLabelValues returns the histogram of the label values in the order of the label names of the family
+func (v *HistogramVec) WithLabelValues(values ...string) metrics.Histogram {
+	return v.withValues(values)
+}
+
+// NewCounterVec creates a family of counters with the given label names in the default registry.
+// The series are registered as tagged metrics, see TaggedName.
+func NewCounterVec(metricName string, labelNames []string, opts ...VecOption) *CounterVec {
+	return DefaultMetrics.NewCounterVec(metricName, labelNames, opts...)
+}
+
+// NewMeterVec creates a family of meters with the given label names in the default registry.
+// The series are registered as tagged metrics, see TaggedName.
+func NewMeterVec(metricName string, labelNames []string, opts ...VecOption) *MeterVec {
+	return DefaultMetrics.NewMeterVec(metricName, labelNames, opts...)
+}
+
+// NewHistogramVec creates a family of histograms with the given label names in the default registry.
+// The series are registered as tagged metrics, see TaggedName.
+func NewHistogramVec(metricName string, labelNames []string, opts ...VecOption) *HistogramVec {
+	return DefaultMetrics.NewHistogramVec(metricName, labelNames, opts...)
+}
+
+// NewCounterVec creates a family of counters with the given label names.
+func (m *Metrics) NewCounterVec(metricName string, labelNames []string, opts ...VecOption) *CounterVec {
+	return &CounterVec{newMetricVec(m, metricName, labelNames, opts, m.GetCounter,
+		func(c metrics.Counter) int64 { return c.Count() })}
+}
+
+// NewMeterVec creates a family of meters with the given label names.
+func (m *Metrics) NewMeterVec(metricName string, labelNames []string, opts ...VecOption) *MeterVec {
+	return &MeterVec{newMetricVec(m, metricName, labelNames, opts, m.GetMeter,
+		func(meter metrics.Meter) int64 { return meter.Count() })}
+}
+
+// NewHistogramVec creates a family of histograms with the given label names.
+func (m *Metrics) NewHistogramVec(metricName string, labelNames []string, opts ...VecOption) *HistogramVec {
+	return &HistogramVec{newMetricVec(m, metricName, labelNames, opts, m.GetHistogram,
+		func(h metrics.Histogram) int64 { return h.Count() })}
+}
@@ -0,0 +1,78 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	m := NewMetrics(nil)
+	vec := m.NewCounterVec("kafka.messages", []string{"topic", "partition"})
+	vec.With(map[string]string{"topic": "events", "partition": "1"}).Inc(2)
+	vec.WithLabelValues("events", "1").Inc(1)
+
+	assert.Equal(t, int64(3), m.GetTaggedCounter("kafka.messages", map[string]string{"topic": "events", "partition": "1"}).Count())
+	assert.Panics(t, func() { vec.WithLabelValues("events") })
+}
+
+func TestMeterVecMaxCardinality(t *testing.T) {
+	m := NewMetrics(nil)
+	vec := m.NewMeterVec("requests", []string{"customer"}, WithMaxCardinality(2))
+	vec.WithLabelValues("a").Mark(1)
+	vec.WithLabelValues("b").Mark(1)
+	vec.WithLabelValues("c").Mark(1)
+	vec.WithLabelValues("d").Mark(2)
+	vec.WithLabelValues("a").Mark(1)
+
+	assert.Equal(t, int64(2), m.GetTaggedMeter("requests", map[string]string{"customer": "a"}).Count())
+	assert.Equal(t, int64(3), m.GetTaggedMeter("requests", map[string]string{"customer": OverflowLabelValue}).Count())
+	assert.Nil(t, m.Registry().Get("requests;customer=c"))
+	assert.Len(t, vec.children, 3, "the overflow series comes on top of the limit")
+}
+
+func TestHistogramVecIdleExpiry(t *testing.T) {
+	m := NewMetrics(nil)
+	vec := m.NewHistogramVec("latency", []string{"route"}, WithIdleExpiry(time.Minute))
+	now := time.Unix(0, 0)
+	vec.now = func() time.Time { return now }
+
+	vec.WithLabelValues("/a").Update(1)
+	vec.WithLabelValues("/b").Update(1)
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, 0, vec.ExpireIdle())
+
+	now = now.Add(30 * time.Second)
+	vec.WithLabelValues("/a").Update(2)
+	assert.Equal(t, 0, vec.ExpireIdle())
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, 1, vec.ExpireIdle())
+	assert.NotNil(t, m.Registry().Get("latency;route=/a"))
+	assert.Nil(t, m.Registry().Get("latency;route=/b"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, int64(0), vec.WithLabelValues("/b").Count())
+	assert.Nil(t, m.Registry().Get("latency;route=/a"))
+}
+
+func TestCounterVecSanitizedCollision(t *testing.T) {
+	m := NewMetrics(nil)
+	vec := m.NewCounterVec("requests", []string{"client"}, WithIdleExpiry(time.Minute))
+	now := time.Unix(0, 0)
+	vec.now = func() time.Time { return now }
+
+	vec.WithLabelValues("a b").Inc(1)
+	vec.WithLabelValues("a_b").Inc(1)
+	assert.Equal(t, int64(2), m.GetCounter("requests;client=a_b").Count(),
+		"label values with the same tagged name share one series")
+
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, 0, vec.ExpireIdle())
+	now = now.Add(30 * time.Second)
+	vec.WithLabelValues("a_b").Inc(1)
+	now = now.Add(40 * time.Second)
+	assert.Equal(t, 0, vec.ExpireIdle())
+	assert.NotNil(t, m.Registry().Get("requests;client=a_b"))
+}
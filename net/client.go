@@ -0,0 +1,226 @@
+package net
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Options configures the http client created by NewHTTPClient, zero values use the defaults
+type Options struct {
+	// ProxyURL is a socks5, socks5h, http or https proxy url, see NewProxyDialer.
+	// If it is empty the proxy of the environment variables HTTP_PROXY, HTTPS_PROXY and NO_PROXY is used.
+	ProxyURL string
+
+	// Timeout limits the whole request including reading the response body (default 0, no limit)
+	Timeout time.Duration
+	// DialTimeout limits the tcp connect including the proxy handshake (default 10s)
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout limits the TLS handshake (default 10s)
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits the wait for the response headers after the request was sent (default 30s)
+	ResponseHeaderTimeout time.Duration
+
+	// MaxIdleConns limits the idle connections of all hosts (default 100)
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits the idle connections per host (default 10)
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections per host (default 0, no limit)
+	MaxConnsPerHost int
+	// IdleConnTimeout closes idle connections after this duration (default 90s)
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives uses every connection for a single request only
+	DisableKeepAlives bool
+
+	// DisableHTTP2 restricts the client to HTTP/1.1
+	DisableHTTP2 bool
+	// RootCAs replaces the system root certificates
+	RootCAs *x509.CertPool
+	// CAFile is a PEM file with certificates which are trusted in addition to RootCAs or the system roots
+	CAFile string
+	// InsecureSkipVerify disables the verification of the server certificates, only use it for tests
+	InsecureSkipVerify bool
+
+	// MaxRetries retries idempotent requests which failed with a network error or the status 502, 503 or 504
+	// (default 0, no retries)
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, it doubles with every retry (default 100ms)
+	RetryBackoff time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = 10 * time.Second
+	}
+	if o.TLSHandshakeTimeout <= 0 {
+		o.TLSHandshakeTimeout = 10 * time.Second
+	}
+	if o.ResponseHeaderTimeout <= 0 {
+		o.ResponseHeaderTimeout = 30 * time.Second
+	}
+	if o.MaxIdleConns <= 0 {
+		o.MaxIdleConns = 100
+	}
+	if o.MaxIdleConnsPerHost <= 0 {
+		o.MaxIdleConnsPerHost = 10
+	}
+	if o.IdleConnTimeout <= 0 {
+		o.IdleConnTimeout = 90 * time.Second
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 100 * time.Millisecond
+	}
+	return o
+}
+
+// NewHTTPClient creates an http client with the given options.
+// An error is returned if the proxy url or the CA file are invalid.
+func NewHTTPClient(opts Options) (*http.Client, error) {
+	opts = opts.withDefaults()
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	var roundTripper http.RoundTripper = transport
+	if opts.MaxRetries > 0 {
+		roundTripper = &retryTransport{next: transport, maxRetries: opts.MaxRetries, backoff: opts.RetryBackoff}
+	}
+	return &http.Client{Transport: roundTripper, Timeout: opts.Timeout}, nil
+}
+
+// NewTransport creates the transport of NewHTTPClient without retries and overall timeout
+func NewTransport(opts Options) (*http.Transport, error) {
+	opts = opts.withDefaults()
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+	}
+	if opts.DisableHTTP2 {
+		// a non nil empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if opts.ProxyURL == "" {
+		return transport, nil
+	}
+
+	u, err := parseProxyURL(opts.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(u)
+	default:
+		proxyDialer, err := NewProxyDialer(opts.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+			defer cancel()
+			return proxyDialer.DialContext(ctx, network, addr)
+		}
+	}
+	return transport, nil
+}
+
+func (o Options) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{RootCAs: o.RootCAs, InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(o.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	if config.RootCAs == nil {
+		if config.RootCAs, err = x509.SystemCertPool(); err != nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+	}
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+	}
+	return config, nil
+}
+
+// retryTransport retries idempotent requests on network errors and temporary server errors
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isIdempotent(req) {
+		return t.next.RoundTrip(req)
+	}
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt == t.maxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// isIdempotent reports whether the request can be sent again
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package net
+
+import (
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClientSocks5Proxy(t *testing.T) {
+	targets := make(chan string, 1)
+	proxyAddr := startRecordingTestSocks5(t, "", "", targets)
+	target := newTestTarget(t, http.StatusOK, "via socks")
+
+	client, err := NewHTTPClient(Options{ProxyURL: "socks5h://" + proxyAddr, Timeout: 5 * time.Second})
+	assert.Nil(t, err)
+	resp, err := client.Get(target)
+	if assert.Nil(t, err) {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "via socks", string(body))
+		assert.Equal(t, "127.0.0.1", <-targets)
+	}
+
+	_, err = NewHTTPClient(Options{ProxyURL: "ftp://proxy.local"})
+	assert.NotNil(t, err)
+}
+
+func TestNewHTTPClientHTTPProxy(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+
+	client, err := NewHTTPClient(Options{ProxyURL: proxy.URL})
+	assert.Nil(t, err)
+	resp, err := client.Get("http://example.invalid/path")
+	if assert.Nil(t, err) {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "proxied http://example.invalid/path", string(body))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&proxied))
+	}
+}
+
+func TestNewHTTPClientCAFileAndHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{})
+	assert.Nil(t, err)
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err, "the test certificate is not trusted by default")
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(caFile, certPEM, 0o600))
+
+	for _, tc := range []struct {
+		disableHTTP2 bool
+		proto        string
+	}{{false, "HTTP/2.0"}, {true, "HTTP/1.1"}} {
+		client, err := NewHTTPClient(Options{CAFile: caFile, DisableHTTP2: tc.disableHTTP2})
+		assert.Nil(t, err)
+		resp, err := client.Get(server.URL)
+		if assert.Nil(t, err) {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, tc.proto, string(body))
+		}
+	}
+
+	assert.Nil(t, os.WriteFile(caFile, []byte("no certificate"), 0o600))
+	_, err = NewHTTPClient(Options{CAFile: caFile})
+	assert.NotNil(t, err)
+	_, err = NewHTTPClient(Options{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.NotNil(t, err)
+}
+
+func TestNewHTTPClientRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok "+string(body))
+	}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(Options{MaxRetries: 3, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	if assert.Nil(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "ok payload", string(body))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "POST is not retried")
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	client, _ = NewHTTPClient(Options{MaxRetries: 1, RetryBackoff: time.Millisecond})
+	resp, err = client.Get(server.URL)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	}
+}
@@ -0,0 +1,315 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/emetriq/gohelper/retry"
+)
+
+// ErrNoHealthyProxy is returned by ProxyPool.Select if all proxies are ejected
+var ErrNoHealthyProxy = errors.New("no healthy proxy available")
+
+// SelectionStrategy defines how a ProxyPool selects a healthy proxy
+type SelectionStrategy int
+
+const (
+	// RoundRobin selects the healthy proxies in turn
+	RoundRobin SelectionStrategy = iota
+	// LeastLatency selects the healthy proxy with the lowest latency of its last check
+	LeastLatency
+	// StickyByKey selects the same healthy proxy for the same key as long as it stays healthy,
+	// only the keys of an ejected proxy move to other proxies
+	StickyByKey
+)
+
+// defaultPoolCheckInterval is the check interval of Start without a valid interval
+const defaultPoolCheckInterval = 30 * time.Second
+
+// PoolOption configures a ProxyPool
+type PoolOption func(*poolConfig)
+
+type poolConfig struct {
+	strategy     SelectionStrategy
+	checkTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	checkOpts    []ProxyCheckOption
+	metrics      *log.Metrics
+}
+
+// WithSelectionStrategy sets how the pool selects a proxy (default RoundRobin)
+func WithSelectionStrategy(strategy SelectionStrategy) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.strategy = strategy
+	}
+}
+
+// WithCheckTimeout limits a single proxy check (default 10s)
+func WithCheckTimeout(timeout time.Duration) PoolOption {
+	return func(cfg *poolConfig) {
+		if timeout > 0 {
+			cfg.checkTimeout = timeout
+		}
+	}
+}
+
+// WithEjectBackoff sets how long an unhealthy proxy is ejected before it is checked again (default 30s up to 10m).
+// The backoff doubles with every failed check of the ejected proxy.
+func WithEjectBackoff(min, max time.Duration) PoolOption {
+	return func(cfg *poolConfig) {
+		if min > 0 && max >= min {
+			cfg.minBackoff = min
+			cfg.maxBackoff = max
+		}
+	}
+}
+
+// WithPoolCheckOptions validates the responses of the proxy checks, see CheckProxyContext
+func WithPoolCheckOptions(opts ...ProxyCheckOption) PoolOption {
+	return func(cfg *poolConfig) {
+		cfg.checkOpts = append(cfg.checkOpts, opts...)
+	}
+}
+
+// WithPoolMetrics records the metrics of the proxies in m (default log.DefaultMetrics)
+func WithPoolMetrics(m *log.Metrics) PoolOption {
+	return func(cfg *poolConfig) {
+		if m != nil {
+			cfg.metrics = m
+		}
+	}
+}
+
+// ProxyStatus is the health state of a proxy of a ProxyPool
+type ProxyStatus struct {
+	URL     string
+	Healthy bool
+	// Latency of the last successful check
+	Latency time.Duration
+	// LastError of the last failed check or MarkFailed
+	LastError error
+	// Failures is the number of consecutive failed checks
+	Failures int
+	// EjectedUntil is the time the ejected proxy is checked again
+	EjectedUntil time.Time
+}
+
+// pooledProxy is the state of a proxy of the pool
+type pooledProxy struct {
+	ProxyStatus
+	tag     string
+	backoff time.Duration
+}
+
+// ProxyPool selects healthy proxies from a list of proxies.
+// The proxies are checked with CheckProxyContext like CheckSocks5Proxy does, but with a timeout. A proxy whose check
+// failed is ejected with an exponential backoff and re-admitted when a check after the backoff succeeds.
+// All proxies are healthy until their first check.
+//
+// The pool records the metrics proxy_pool.healthy (1 or 0), proxy_pool.check.latency, proxy_pool.check.failures,
+// proxy_pool.ejections and proxy_pool.selected tagged with proxy=<host:port> of every proxy.
+type ProxyPool struct {
+	testURL string
+	cfg     poolConfig
+	now     func() time.Time
+
+	mu      sync.Mutex
+	proxies []*pooledProxy
+	next    int
+}
+
+// NewProxyPool creates a pool of the given proxy urls which are checked by fetching testURL, see NewProxyDialer for
+// the supported proxy urls. An error is returned if a proxy url is invalid.
+func NewProxyPool(proxyURLs []string, testURL string, opts ...PoolOption) (*ProxyPool, error) {
+	cfg := poolConfig{
+		checkTimeout: 10 * time.Second,
+		minBackoff:   30 * time.Second,
+		maxBackoff:   10 * time.Minute,
+		metrics:      log.DefaultMetrics,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	p := &ProxyPool{testURL: testURL, cfg: cfg, now: time.Now}
+	for _, proxyURL := range proxyURLs {
+		d, err := NewProxyDialer(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy := &pooledProxy{ProxyStatus: ProxyStatus{URL: proxyURL, Healthy: true}, tag: d.proxyAddr}
+		p.proxies = append(p.proxies, proxy)
+		p.gauge(proxy)
+	}
+	return p, nil
+}
+
+// Start checks all proxies now and then every interval (30s if interval <= 0) until the returned func is called
+func (p *ProxyPool) Start(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultPoolCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.CheckAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return cancel
+}
+
+// CheckAll checks all proxies concurrently which are not ejected or whose backoff has passed
+func (p *ProxyPool) CheckAll(ctx context.Context) {
+	now := p.now()
+	p.mu.Lock()
+	due := []*pooledProxy{}
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.EjectedUntil) {
+			due = append(due, proxy)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proxy := range due {
+		wg.Add(1)
+		go func(proxy *pooledProxy) {
+			defer wg.Done()
+			p.check(ctx, proxy)
+		}(proxy)
+	}
+	wg.Wait()
+}
+
+func (p *ProxyPool) check(ctx context.Context, proxy *pooledProxy) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.checkTimeout)
+	defer cancel()
+	result, err := CheckProxyContext(ctx, proxy.URL, p.testURL, p.cfg.checkOpts...)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// the pool was stopped during the check
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.cfg.metrics.GetTaggedCounter("proxy_pool.check.failures", p.tags(proxy)).Inc(1)
+		p.eject(proxy, err)
+		return
+	}
+	p.cfg.metrics.GetTaggedTimer("proxy_pool.check.latency", p.tags(proxy)).Update(result.Latency)
+	if !proxy.Healthy {
+		log.Logger.Infof("proxy %s is healthy again", proxy.tag)
+	}
+	proxy.Healthy = true
+	proxy.Latency = result.Latency
+	proxy.Failures = 0
+	proxy.EjectedUntil = time.Time{}
+	proxy.backoff = 0
+	p.gauge(proxy)
+}
+
+// eject marks the proxy unhealthy until its backoff has passed, p.mu must be held
+func (p *ProxyPool) eject(proxy *pooledProxy, err error) {
+	if proxy.Healthy {
+		log.Logger.Warnf("ejecting proxy %s: %v", proxy.tag, err)
+		p.cfg.metrics.GetTaggedCounter("proxy_pool.ejections", p.tags(proxy)).Inc(1)
+	}
+	proxy.Failures++
+	proxy.backoff = retry.Exponential(p.cfg.minBackoff, p.cfg.maxBackoff, 0).Delay(proxy.Failures, proxy.backoff)
+	proxy.Healthy = false
+	proxy.LastError = err
+	proxy.EjectedUntil = p.now().Add(proxy.backoff)
+	p.gauge(proxy)
+}
+
+// MarkFailed ejects the proxy immediately, e.g. after a request through it failed.
+// It does nothing if the proxy is not part of the pool or already ejected.
+func (p *ProxyPool) MarkFailed(proxyURL string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, proxy := range p.proxies {
+		if proxy.URL == proxyURL && proxy.Healthy {
+			p.eject(proxy, err)
+		}
+	}
+}
+
+// Select returns the url of a healthy proxy according to the selection strategy of the pool.
+// The key is only used by StickyByKey, e.g. a user id or a host name.
+func (p *ProxyPool) Select(key string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var selected *pooledProxy
+	switch p.cfg.strategy {
+	case LeastLatency:
+		for _, proxy := range p.proxies {
+			if proxy.Healthy && (selected == nil || proxy.Latency < selected.Latency) {
+				selected = proxy
+			}
+		}
+	case StickyByKey:
+		// rendezvous hashing keeps the assignment of the keys of healthy proxies stable
+		var best uint64
+		for _, proxy := range p.proxies {
+			if !proxy.Healthy {
+				continue
+			}
+			h := fnv.New64a()
+			h.Write([]byte(proxy.URL))
+			h.Write([]byte{0})
+			h.Write([]byte(key))
+			if score := h.Sum64(); selected == nil || score > best {
+				selected, best = proxy, score
+			}
+		}
+	default:
+		for i := 0; i < len(p.proxies) && selected == nil; i++ {
+			proxy := p.proxies[(p.next+i)%len(p.proxies)]
+			if proxy.Healthy {
+				selected = proxy
+				p.next = (p.next + i + 1) % len(p.proxies)
+			}
+		}
+	}
+	if selected == nil {
+		return "", ErrNoHealthyProxy
+	}
+	p.cfg.metrics.GetTaggedCounter("proxy_pool.selected", p.tags(selected)).Inc(1)
+	return selected.URL, nil
+}
+
+// Status returns the health state of all proxies in the order of the pool
+func (p *ProxyPool) Status() []ProxyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := make([]ProxyStatus, len(p.proxies))
+	for idx, proxy := range p.proxies {
+		status[idx] = proxy.ProxyStatus
+	}
+	return status
+}
+
+// tags are the metric tags of the proxy, they contain the address without credentials
+func (p *ProxyPool) tags(proxy *pooledProxy) map[string]string {
+	return map[string]string{"proxy": proxy.tag}
+}
+
+func (p *ProxyPool) gauge(proxy *pooledProxy) {
+	var healthy int64
+	if proxy.Healthy {
+		healthy = 1
+	}
+	p.cfg.metrics.GetTaggedGauge("proxy_pool.healthy", p.tags(proxy)).Update(healthy)
+}
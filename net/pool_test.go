@@ -0,0 +1,122 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// deadProxyAddr returns an address nobody listens on
+func deadProxyAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestProxyPoolEjectAndReadmit(t *testing.T) {
+	healthy := startTestSocks5(t, "", "")
+	dead := deadProxyAddr(t)
+	m := log.NewMetrics(nil)
+	pool, err := NewProxyPool([]string{healthy, dead}, newTestTarget(t, http.StatusOK, "ok"),
+		WithEjectBackoff(time.Minute, 4*time.Minute), WithCheckTimeout(2*time.Second), WithPoolMetrics(m))
+	assert.Nil(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+
+	pool.CheckAll(context.Background())
+	status := pool.Status()
+	assert.True(t, status[0].Healthy)
+	assert.False(t, status[1].Healthy)
+	assert.Equal(t, 1, status[1].Failures)
+	assert.Equal(t, now.Add(time.Minute), status[1].EjectedUntil)
+	assert.Equal(t, int64(0), m.Registry().Get("proxy_pool.healthy;proxy="+dead).(metrics.Gauge).Value())
+	assert.Equal(t, int64(1), m.Registry().Get("proxy_pool.healthy;proxy="+healthy).(metrics.Gauge).Value())
+	assert.Equal(t, int64(1), m.Registry().Get("proxy_pool.ejections;proxy="+dead).(metrics.Counter).Count())
+
+	for i := 0; i < 3; i++ {
+		selected, err := pool.Select("")
+		assert.Nil(t, err)
+		assert.Equal(t, healthy, selected)
+	}
+	assert.Equal(t, int64(3), m.Registry().Get("proxy_pool.selected;proxy="+healthy).(metrics.Counter).Count())
+
+	// the ejected proxy is not checked before its backoff passed
+	now = now.Add(30 * time.Second)
+	pool.CheckAll(context.Background())
+	assert.Equal(t, 1, pool.Status()[1].Failures)
+
+	// the backoff doubles with every failed check
+	now = now.Add(30 * time.Second)
+	pool.CheckAll(context.Background())
+	status = pool.Status()
+	assert.Equal(t, 2, status[1].Failures)
+	assert.Equal(t, now.Add(2*time.Minute), status[1].EjectedUntil)
+	assert.Equal(t, int64(1), m.Registry().Get("proxy_pool.ejections;proxy="+dead).(metrics.Counter).Count())
+	assert.Equal(t, int64(2), m.Registry().Get("proxy_pool.check.failures;proxy="+dead).(metrics.Counter).Count())
+
+	pool.MarkFailed(healthy, errors.New("request failed"))
+	_, err = pool.Select("")
+	assert.Equal(t, ErrNoHealthyProxy, err)
+
+	// the healthy proxy is re-admitted after its backoff
+	now = now.Add(time.Minute)
+	pool.CheckAll(context.Background())
+	status = pool.Status()
+	assert.True(t, status[0].Healthy)
+	assert.Equal(t, 0, status[0].Failures)
+	assert.True(t, status[0].EjectedUntil.IsZero())
+}
+
+func TestProxyPoolSelection(t *testing.T) {
+	proxies := []string{"socks5://127.0.0.1:1081", "socks5://127.0.0.1:1082", "socks5://127.0.0.1:1083"}
+	pool, err := NewProxyPool(proxies, "http://example.invalid", WithPoolMetrics(log.NewMetrics(nil)))
+	assert.Nil(t, err)
+	selected := []string{}
+	for i := 0; i < 4; i++ {
+		proxy, _ := pool.Select("")
+		selected = append(selected, proxy)
+	}
+	assert.Equal(t, []string{proxies[0], proxies[1], proxies[2], proxies[0]}, selected)
+
+	pool.cfg.strategy = LeastLatency
+	pool.proxies[0].Latency = 30 * time.Millisecond
+	pool.proxies[1].Latency = 10 * time.Millisecond
+	pool.proxies[2].Latency = 20 * time.Millisecond
+	proxy, _ := pool.Select("")
+	assert.Equal(t, proxies[1], proxy)
+	pool.MarkFailed(proxies[1], errors.New("down"))
+	proxy, _ = pool.Select("")
+	assert.Equal(t, proxies[2], proxy)
+	pool.proxies[1].Healthy = true
+
+	pool.cfg.strategy = StickyByKey
+	assignment := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		assignment[key], _ = pool.Select(key)
+		again, _ := pool.Select(key)
+		assert.Equal(t, assignment[key], again)
+	}
+	pool.MarkFailed(proxies[0], errors.New("down"))
+	for key, proxy := range assignment {
+		moved, _ := pool.Select(key)
+		if proxy == proxies[0] {
+			assert.NotEqual(t, proxies[0], moved)
+		} else {
+			assert.Equal(t, proxy, moved, "only keys of the ejected proxy move")
+		}
+	}
+
+	_, err = NewProxyPool([]string{"ftp://proxy.local"}, "http://example.invalid")
+	assert.NotNil(t, err)
+
+	assert.NotPanics(t, func() { pool.Start(0)() }, "an invalid interval uses the default")
+}
@@ -1,50 +1,27 @@
 package net
 
 import (
-	"errors"
-	"io/ioutil"
-	"net/http"
+	"context"
 	"time"
-
-	"golang.org/x/net/proxy"
 )
 
+// CheckSocks5Proxy fetches testUrl through the proxy and validates the response. There is no overall deadline,
+// only the TLS handshake (10s) and response header (30s) timeouts of NewTransport apply. proxyAddr is either
+// host:port of a SOCKS5 proxy or a proxy url, see NewProxyDialer. Use CheckProxyContext for a deadline.
 func CheckSocks5Proxy(proxyAddr string, testUrl string) error {
-	// create a socks5 dialer
-	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
-	if err != nil {
-		return err
-	}
-	// setup a http client
-	httpTransport := &http.Transport{
-		Dial: dialer.Dial,
-	}
-	httpClient := &http.Client{Transport: httpTransport}
-	// create a request
-	req, err := http.NewRequest("GET", testUrl, nil)
-	if err != nil {
-		return err
-	}
-	// use the http client to fetch the page
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	_, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := CheckProxyContext(context.Background(), proxyAddr, testUrl)
+	return err
 }
 
+// WaitForSocks5Proxy checks the proxy up to maxCheckCount times and waits waitTimeSeconds after every failed check.
+// proxUrl is either host:port of a SOCKS5 proxy or a proxy url, see NewProxyDialer. The returned error is a
+// *ProxyWaitError. Use WaitForProxyContext for cancellation and exponential backoff.
 func WaitForSocks5Proxy(proxUrl string, testUrl string, waitTimeSeconds int, maxCheckCount int) error {
-	for i := 0; i < maxCheckCount; i++ {
-		err := CheckSocks5Proxy(proxUrl, testUrl)
-		time.Sleep(time.Second * time.Duration(waitTimeSeconds))
-		if err == nil {
-			return nil
-		}
+	if maxCheckCount <= 0 {
+		return &ProxyWaitError{}
 	}
-	return errors.New("proxy check failed")
+	wait := time.Second * time.Duration(waitTimeSeconds)
+	_, err := WaitForProxyContext(context.Background(), proxUrl, testUrl,
+		WithMaxAttempts(maxCheckCount), WithBackoff(wait, wait), WithJitter(0), WithAttemptTimeout(0))
+	return err
 }
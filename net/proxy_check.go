@@ -0,0 +1,193 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxyCheckStage is the step of a proxy check
+type ProxyCheckStage string
+
+const (
+	// StageDial is the tcp connection to the proxy
+	StageDial ProxyCheckStage = "dial"
+	// StageHandshake is the SOCKS5 or HTTP CONNECT handshake including the authentication and the connect to the target
+	StageHandshake ProxyCheckStage = "handshake"
+	// StageHTTP is the http request to the test url through the proxy
+	StageHTTP ProxyCheckStage = "http"
+	// StageValidation is the validation of the status code and the body of the response
+	StageValidation ProxyCheckStage = "validation"
+)
+
+// ProxyCheckError is returned by CheckProxyContext with the stage the check failed in
+type ProxyCheckError struct {
+	Stage ProxyCheckStage
+	Err   error
+}
+
+func (e *ProxyCheckError) Error() string {
+	return fmt.Sprintf("proxy check failed in %s stage: %v", e.Stage, e.Err)
+}
+
+func (e *ProxyCheckError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyCheckResult is the outcome of a proxy check
+type ProxyCheckResult struct {
+	// Stage is the last stage the check reached, StageValidation if it passed
+	Stage ProxyCheckStage
+	// Latency is the duration from the start of the check until the response was validated or the check failed
+	Latency time.Duration
+	// StatusCode of the response or 0 if there was none
+	StatusCode int
+	// ExitIP is the ip address reported by the test url if it responds with an ip address as plain text or
+	// as json field ip or origin, e.g. https://api.ipify.org
+	ExitIP string
+}
+
+// ProxyCheckOption configures a proxy check
+type ProxyCheckOption func(*proxyCheckConfig)
+
+type proxyCheckConfig struct {
+	auth           *proxy.Auth
+	expectedStatus int
+	bodyPredicate  func(body []byte) bool
+	maxBodyBytes   int64
+}
+
+// WithProxyAuth authenticates at the proxy with username and password instead of the credentials of the proxy url
+func WithProxyAuth(username string, password string) ProxyCheckOption {
+	return func(cfg *proxyCheckConfig) {
+		cfg.auth = &proxy.Auth{User: username, Password: password}
+	}
+}
+
+// WithExpectedStatus fails the check if the response has a different status code (default any status code)
+func WithExpectedStatus(code int) ProxyCheckOption {
+	return func(cfg *proxyCheckConfig) {
+		cfg.expectedStatus = code
+	}
+}
+
+// WithBodyPredicate fails the check if the predicate returns false for the (bounded) response body
+func WithBodyPredicate(predicate func(body []byte) bool) ProxyCheckOption {
+	return func(cfg *proxyCheckConfig) {
+		cfg.bodyPredicate = predicate
+	}
+}
+
+// WithMaxBodyBytes limits how much of the response body is read (default 64 KiB)
+func WithMaxBodyBytes(n int64) ProxyCheckOption {
+	return func(cfg *proxyCheckConfig) {
+		if n > 0 {
+			cfg.maxBodyBytes = n
+		}
+	}
+}
+
+// CheckProxyContext fetches testURL through the proxy and validates the response, see NewProxyDialer for the
+// supported proxy urls. The deadline of ctx limits the whole check. On failure the returned error is a
+// *ProxyCheckError with the stage the check failed in, the result is filled up to that stage.
+func CheckProxyContext(ctx context.Context, proxyURL string, testURL string, opts ...ProxyCheckOption) (ProxyCheckResult, error) {
+	cfg := proxyCheckConfig{maxBodyBytes: 64 << 10}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	start := time.Now()
+	result := ProxyCheckResult{Stage: StageDial}
+	fail := func(stage ProxyCheckStage, err error) (ProxyCheckResult, error) {
+		result.Stage = stage
+		result.Latency = time.Since(start)
+		return result, &ProxyCheckError{Stage: stage, Err: err}
+	}
+
+	dialer, err := NewProxyDialer(proxyURL)
+	if err != nil {
+		return fail(StageDial, err)
+	}
+	if cfg.auth != nil {
+		dialer.auth = cfg.auth
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testURL, nil)
+	if err != nil {
+		return fail(StageHTTP, err)
+	}
+	// the transport may still dial in the background when the request is canceled
+	var dialMu sync.Mutex
+	var dialErr *ProxyCheckError
+	transport, err := NewTransport(Options{DisableKeepAlives: true})
+	if err != nil {
+		return fail(StageHTTP, err)
+	}
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, stage, err := dialer.dialStaged(ctx, network, addr)
+		if err != nil {
+			dialMu.Lock()
+			dialErr = &ProxyCheckError{Stage: stage, Err: err}
+			dialMu.Unlock()
+			return nil, err
+		}
+		return conn, nil
+	}
+	defer transport.CloseIdleConnections()
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		dialMu.Lock()
+		defer dialMu.Unlock()
+		if dialErr != nil {
+			return fail(dialErr.Stage, dialErr.Err)
+		}
+		return fail(StageHTTP, err)
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.maxBodyBytes))
+	if err != nil {
+		return fail(StageHTTP, err)
+	}
+	result.ExitIP = exitIP(body)
+
+	if cfg.expectedStatus != 0 && resp.StatusCode != cfg.expectedStatus {
+		return fail(StageValidation, fmt.Errorf("expected status %d but got %d", cfg.expectedStatus, resp.StatusCode))
+	}
+	if cfg.bodyPredicate != nil && !cfg.bodyPredicate(body) {
+		return fail(StageValidation, errors.New("response body rejected"))
+	}
+	result.Stage = StageValidation
+	result.Latency = time.Since(start)
+	return result, nil
+}
+
+// exitIP extracts an ip address from a plain text or json response body
+func exitIP(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if ip := net.ParseIP(text); ip != nil {
+		return ip.String()
+	}
+	var fields struct {
+		IP     string `json:"ip"`
+		Origin string `json:"origin"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	for _, candidate := range []string{fields.IP, fields.Origin} {
+		if ip := net.ParseIP(strings.TrimSpace(candidate)); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTestSocks5 starts a Socks5Server on a random local port, if user is set it requires username and password
+func startTestSocks5(t *testing.T, user string, password string) string {
+	return startRecordingTestSocks5(t, user, password, nil)
+}
+
+// startRecordingTestSocks5 starts a test SOCKS5 server which sends the requested target hosts to targets if it
+// is not nil
+func startRecordingTestSocks5(t *testing.T, user string, password string, targets chan<- string) string {
+	opts := []Socks5ServerOption{WithSocks5Metrics(log.NewMetrics(nil))}
+	if user != "" {
+		opts = append(opts, WithSocks5Credentials(user, password))
+	} else {
+		opts = append(opts, WithSocks5NoAuth())
+	}
+	if targets != nil {
+		opts = append(opts, WithSocks5Dialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(addr)
+			targets <- host
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}))
+	}
+	server, addr, err := StartSocks5Server("127.0.0.1:0", opts...)
+	assert.Nil(t, err)
+	t.Cleanup(func() { server.Close() })
+	return addr
+}
+
+func newTestTarget(t *testing.T, status int, body string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCheckSocks5Proxy(t *testing.T) {
+	proxyAddr := startTestSocks5(t, "", "")
+	assert.Nil(t, CheckSocks5Proxy(proxyAddr, newTestTarget(t, http.StatusOK, "ok")))
+}
+
+func TestCheckProxyContext(t *testing.T) {
+	proxyAddr := startTestSocks5(t, "user", "secret")
+	target := newTestTarget(t, http.StatusOK, `{"ip": "203.0.113.7"}`)
+
+	result, err := CheckProxyContext(context.Background(), proxyAddr, target,
+		WithProxyAuth("user", "secret"), WithExpectedStatus(http.StatusOK))
+	assert.Nil(t, err)
+	assert.Equal(t, StageValidation, result.Stage)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "203.0.113.7", result.ExitIP)
+	assert.Greater(t, result.Latency, time.Duration(0))
+
+	_, err = CheckProxyContext(context.Background(), proxyAddr, target, WithProxyAuth("user", "wrong"))
+	var checkErr *ProxyCheckError
+	assert.True(t, errors.As(err, &checkErr))
+	assert.Equal(t, StageHandshake, checkErr.Stage)
+
+	result, err = CheckProxyContext(context.Background(), proxyAddr, target, WithProxyAuth("user", "secret"),
+		WithBodyPredicate(func(body []byte) bool { return string(body) == "pong" }))
+	assert.True(t, errors.As(err, &checkErr))
+	assert.Equal(t, StageValidation, checkErr.Stage)
+	assert.Equal(t, StageValidation, result.Stage)
+}
+
+func TestCheckProxyContextStages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	result, err := CheckProxyContext(context.Background(), unreachable, "http://example.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, StageDial, result.Stage)
+
+	proxyAddr := startTestSocks5(t, "", "")
+	result, _ = CheckProxyContext(context.Background(), proxyAddr, newTestTarget(t, http.StatusBadGateway, "1.2.3.4\n"),
+		WithExpectedStatus(http.StatusOK))
+	assert.Equal(t, StageValidation, result.Stage)
+	assert.Equal(t, http.StatusBadGateway, result.StatusCode)
+	assert.Equal(t, "1.2.3.4", result.ExitIP)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer slow.Close()
+	result, err = CheckProxyContext(ctx, proxyAddr, slow.URL)
+	assert.NotNil(t, err)
+	assert.Equal(t, StageHTTP, result.Stage)
+}
+
+func TestExitIP(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", exitIP([]byte(`{"origin": "10.0.0.1"}`)))
+	assert.Equal(t, "", exitIP([]byte("<html></html>")))
+}
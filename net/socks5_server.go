@@ -0,0 +1,507 @@
+package net
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+)
+
+// SOCKS5 protocol constants, see RFC 1928 and RFC 1929
+const (
+	socks5Version         = 5
+	socks5AuthVersion     = 1
+	socks5NoAuth          = 0
+	socks5UserPassAuth    = 2
+	socks5NoAcceptable    = 0xff
+	socks5CmdConnect      = 1
+	socks5AtypIPv4        = 1
+	socks5AtypDomain      = 3
+	socks5AtypIPv6        = 4
+	socks5Succeeded       = 0
+	socks5GeneralFailure  = 1
+	socks5NotAllowed      = 2
+	socks5HostUnreachable = 4
+	socks5ConnRefused     = 5
+	socks5CmdUnsupported  = 7
+	socks5AtypUnsupported = 8
+)
+
+// Socks5ServerOption configures a Socks5Server
+type Socks5ServerOption func(*socks5ServerConfig)
+
+type socks5ServerConfig struct {
+	credentials      map[string]string
+	noAuth           bool
+	allowHosts       []string
+	allowNets        []*net.IPNet
+	dial             func(ctx context.Context, network, addr string) (net.Conn, error)
+	handshakeTimeout time.Duration
+	metrics          *log.Metrics
+}
+
+// WithSocks5Credentials requires username and password authentication and adds a valid user
+func WithSocks5Credentials(username string, password string) Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		cfg.credentials[username] = password
+	}
+}
+
+// WithSocks5NoAuth accepts clients without authentication if no credentials are set, e.g. for a proxy which
+// only listens on localhost. Without credentials and without this option the server refuses to serve,
+// so it can not become an open proxy by accident.
+func WithSocks5NoAuth() Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		cfg.noAuth = true
+	}
+}
+
+// WithSocks5AllowList restricts the targets to the given entries, which are host names, wildcards like
+// *.example.com, ip addresses or CIDR networks like 10.0.0.0/8. Host names of targets which do not match a name
+// entry are resolved and their addresses are checked against the ip entries. Invalid entries are ignored.
+// Without an allow list all targets are allowed.
+func WithSocks5AllowList(entries ...string) Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		for _, entry := range entries {
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				cfg.allowNets = append(cfg.allowNets, network)
+			} else if ip := net.ParseIP(entry); ip != nil {
+				cfg.allowNets = append(cfg.allowNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			} else if entry != "" {
+				cfg.allowHosts = append(cfg.allowHosts, strings.ToLower(entry))
+			}
+		}
+	}
+}
+
+// WithSocks5Dialer sets how the server connects to the targets (default a net.Dialer with a 10s timeout),
+// e.g. to bind to a specific interface or to chain another proxy
+func WithSocks5Dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		if dial != nil {
+			cfg.dial = dial
+		}
+	}
+}
+
+// WithSocks5HandshakeTimeout limits the handshake of a client including the connect to the target (default 10s)
+func WithSocks5HandshakeTimeout(d time.Duration) Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		if d > 0 {
+			cfg.handshakeTimeout = d
+		}
+	}
+}
+
+// WithSocks5Metrics records the metrics of the server in m (default log.DefaultMetrics)
+func WithSocks5Metrics(m *log.Metrics) Socks5ServerOption {
+	return func(cfg *socks5ServerConfig) {
+		if m != nil {
+			cfg.metrics = m
+		}
+	}
+}
+
+// Socks5Server is a small SOCKS5 proxy which supports CONNECT with username and password or, with WithSocks5NoAuth,
+// without authentication.
+// It can be started on a random local port in tests or used as a local egress proxy.
+//
+// The server records the metrics socks5_server.connections (accepted clients), socks5_server.active (open tunnels),
+// socks5_server.auth_failures, socks5_server.denied (targets not on the allow list), socks5_server.dial_errors and
+// the meters socks5_server.bytes_sent and socks5_server.bytes_received (to and from the clients).
+type Socks5Server struct {
+	cfg socks5ServerConfig
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewSocks5Server creates a server, use Serve or ListenAndServe to accept clients.
+// They return ErrNoAuthentication if neither WithSocks5Credentials nor WithSocks5NoAuth is set.
+func NewSocks5Server(opts ...Socks5ServerOption) *Socks5Server {
+	cfg := socks5ServerConfig{
+		credentials:      map[string]string{},
+		dial:             (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		handshakeTimeout: 10 * time.Second,
+		metrics:          log.DefaultMetrics,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.metrics = cfg.metrics.Child("socks5_server")
+	return &Socks5Server{cfg: cfg, listeners: map[net.Listener]struct{}{}, conns: map[net.Conn]struct{}{}}
+}
+
+// StartSocks5Server listens on addr and serves clients in the background until Close is called.
+// It returns the address the server listens on, use 127.0.0.1:0 for a random local port.
+func StartSocks5Server(addr string, opts ...Socks5ServerOption) (*Socks5Server, string, error) {
+	s := NewSocks5Server(opts...)
+	if err := s.checkAuth(); err != nil {
+		return nil, "", err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	go s.Serve(listener)
+	return s, listener.Addr().String(), nil
+}
+
+// ListenAndServe listens on addr and serves clients until Close is called
+func (s *Socks5Server) ListenAndServe(addr string) error {
+	if err := s.checkAuth(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// ErrServerClosed is returned by Serve and ListenAndServe after Close was called
+var ErrServerClosed = errors.New("socks5 server closed")
+
+// ErrNoAuthentication is returned when a server without credentials is started without WithSocks5NoAuth
+var ErrNoAuthentication = errors.New("socks5 server needs WithSocks5Credentials or WithSocks5NoAuth")
+
+// checkAuth returns ErrNoAuthentication if the server would be an open proxy without the explicit opt-in
+func (s *Socks5Server) checkAuth() error {
+	if len(s.cfg.credentials) == 0 && !s.cfg.noAuth {
+		return ErrNoAuthentication
+	}
+	return nil
+}
+
+// Serve accepts clients on the listener until Close is called, the listener is closed by Close
+func (s *Socks5Server) Serve(listener net.Listener) error {
+	if err := s.checkAuth(); err != nil {
+		listener.Close()
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.listeners, listener)
+			if s.closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.cfg.metrics.GetCounter("connections").Inc(1)
+		go func() {
+			defer s.untrack(conn)
+			s.serve(conn)
+		}()
+	}
+}
+
+// Close stops accepting clients, closes all open connections and waits until their goroutines finished
+func (s *Socks5Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// track registers a client connection, so Close can close it and wait for its goroutine
+func (s *Socks5Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Socks5Server) untrack(conn net.Conn) {
+	s.unregister(conn)
+	s.wg.Done()
+}
+
+// register adds a connection which is closed by Close, it returns false if the server is already closed
+func (s *Socks5Server) register(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Socks5Server) unregister(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// serve runs the handshake with a client and relays the data between the client and the target
+func (s *Socks5Server) serve(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.handshakeTimeout)
+	defer cancel()
+	conn.SetDeadline(time.Now().Add(s.cfg.handshakeTimeout))
+	if err := s.authenticate(conn); err != nil {
+		log.Logger.Debugf("socks5 client %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	target, err := s.connect(ctx, conn)
+	if err != nil {
+		log.Logger.Debugf("socks5 client %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if !s.register(target) {
+		target.Close()
+		return
+	}
+	defer s.unregister(target)
+	conn.SetDeadline(time.Time{})
+
+	active := s.cfg.metrics.GetCounter("active")
+	active.Inc(1)
+	defer active.Dec(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay(target, conn, s.cfg.metrics.GetMeter("bytes_received"))
+	}()
+	relay(conn, target, s.cfg.metrics.GetMeter("bytes_sent"))
+	<-done
+}
+
+// relay copies from src to dst and closes the write side of dst when src is done
+func relay(dst net.Conn, src net.Conn, bytes interface{ Mark(int64) }) {
+	n, _ := io.Copy(dst, src)
+	bytes.Mark(n)
+	if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
+
+// authenticate negotiates the authentication method and checks the credentials
+func (s *Socks5Server) authenticate(conn net.Conn) error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != socks5Version {
+		return fmt.Errorf("unsupported socks version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	method := byte(socks5NoAuth)
+	if len(s.cfg.credentials) > 0 {
+		method = socks5UserPassAuth
+	}
+	offered := false
+	for _, m := range methods {
+		offered = offered || m == method
+	}
+	if !offered {
+		s.cfg.metrics.GetCounter("auth_failures").Inc(1)
+		conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return errors.New("no acceptable authentication method offered")
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return err
+	}
+	if method == socks5NoAuth {
+		return nil
+	}
+
+	// username and password subnegotiation of RFC 1929
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return err
+	}
+	if version[0] != socks5AuthVersion {
+		s.cfg.metrics.GetCounter("auth_failures").Inc(1)
+		conn.Write([]byte{socks5AuthVersion, 1})
+		return fmt.Errorf("unsupported authentication version %d", version[0])
+	}
+	username := make([]byte, version[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return err
+	}
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return err
+	}
+	password := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return err
+	}
+	if expected, ok := s.cfg.credentials[string(username)]; !ok || expected != string(password) {
+		s.cfg.metrics.GetCounter("auth_failures").Inc(1)
+		conn.Write([]byte{socks5AuthVersion, 1})
+		return fmt.Errorf("authentication of user %q failed", username)
+	}
+	_, err := conn.Write([]byte{socks5AuthVersion, 0})
+	return err
+}
+
+// connect reads the request of the client, connects to the target and sends the reply
+func (s *Socks5Server) connect(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	var host string
+	switch request[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		ip := make([]byte, net.IPv4len)
+		if request[3] == socks5AtypIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case socks5AtypDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		writeSocks5Reply(conn, socks5AtypUnsupported, nil)
+		return nil, fmt.Errorf("unsupported address type %d", request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	if request[1] != socks5CmdConnect {
+		writeSocks5Reply(conn, socks5CmdUnsupported, nil)
+		return nil, fmt.Errorf("unsupported command %d", request[1])
+	}
+
+	addr, err := s.allowedAddr(ctx, host)
+	if err != nil {
+		s.cfg.metrics.GetCounter("denied").Inc(1)
+		writeSocks5Reply(conn, socks5NotAllowed, nil)
+		return nil, err
+	}
+	target, err := s.cfg.dial(ctx, "tcp", net.JoinHostPort(addr, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		s.cfg.metrics.GetCounter("dial_errors").Inc(1)
+		writeSocks5Reply(conn, dialErrorReply(err), nil)
+		return nil, err
+	}
+	if err := writeSocks5Reply(conn, socks5Succeeded, target.LocalAddr()); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+// allowedAddr returns the host or, if it was resolved for the allow list, its allowed ip address
+func (s *Socks5Server) allowedAddr(ctx context.Context, host string) (string, error) {
+	if len(s.cfg.allowHosts) == 0 && len(s.cfg.allowNets) == 0 {
+		return host, nil
+	}
+	name := strings.ToLower(host)
+	for _, pattern := range s.cfg.allowHosts {
+		if name == pattern || strings.HasPrefix(pattern, "*.") && strings.HasSuffix(name, pattern[1:]) {
+			return host, nil
+		}
+	}
+	if len(s.cfg.allowNets) == 0 {
+		return "", fmt.Errorf("target %s is not allowed", host)
+	}
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		for _, network := range s.cfg.allowNets {
+			if network.Contains(ip) {
+				return ip.String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("target %s is not allowed", host)
+}
+
+// dialErrorReply maps a dial error to a SOCKS5 reply code
+func dialErrorReply(err error) byte {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return socks5HostUnreachable
+	case errors.As(err, &opErr) && strings.Contains(opErr.Err.Error(), "refused"):
+		return socks5ConnRefused
+	case errors.As(err, &opErr):
+		return socks5HostUnreachable
+	}
+	return socks5GeneralFailure
+}
+
+// writeSocks5Reply sends a reply with the bound address, an unknown address is sent as 0.0.0.0:0
+func writeSocks5Reply(conn net.Conn, code byte, bound net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if tcpAddr, ok := bound.(*net.TCPAddr); ok {
+		ip, port = tcpAddr.IP, tcpAddr.Port
+	}
+	reply := []byte{socks5Version, code, 0}
+	if ip4 := ip.To4(); ip4 != nil {
+		reply = append(append(reply, socks5AtypIPv4), ip4...)
+	} else {
+		reply = append(append(reply, socks5AtypIPv6), ip.To16()...)
+	}
+	reply = append(reply, byte(port>>8), byte(port))
+	_, err := conn.Write(reply)
+	return err
+}
@@ -0,0 +1,172 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocks5ServerAuth(t *testing.T) {
+	m := log.NewMetrics(nil)
+	server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5Credentials("user", "secret"),
+		WithSocks5Credentials("other", "pw"), WithSocks5Metrics(m))
+	assert.Nil(t, err)
+	defer server.Close()
+	target := newTestTarget(t, http.StatusOK, "ok")
+
+	assert.Nil(t, CheckSocks5Proxy("socks5h://user:secret@"+addr, target))
+	assert.Nil(t, CheckSocks5Proxy("socks5h://other:pw@"+addr, target))
+
+	_, err = CheckProxyContext(context.Background(), "socks5h://user:wrong@"+addr, target)
+	var checkErr *ProxyCheckError
+	if assert.True(t, errors.As(err, &checkErr)) {
+		assert.Equal(t, StageHandshake, checkErr.Stage)
+	}
+	_, err = CheckProxyContext(context.Background(), addr, target)
+	assert.NotNil(t, err, "clients without credentials are rejected")
+
+	assert.Equal(t, int64(4), m.Registry().Get("socks5_server.connections").(metrics.Counter).Count())
+	assert.Equal(t, int64(2), m.Registry().Get("socks5_server.auth_failures").(metrics.Counter).Count())
+	// the tunnels record their bytes when they are closed
+	assert.Eventually(t, func() bool {
+		sent, ok := m.Registry().Get("socks5_server.bytes_sent").(metrics.Meter)
+		received, ok2 := m.Registry().Get("socks5_server.bytes_received").(metrics.Meter)
+		return ok && ok2 && sent.Count() > 0 && received.Count() > 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestSocks5ServerRequiresAuthOptIn(t *testing.T) {
+	server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5Metrics(log.NewMetrics(nil)))
+	assert.Equal(t, ErrNoAuthentication, err, "a server without credentials is no open proxy by accident")
+	assert.Nil(t, server)
+	assert.Empty(t, addr)
+	assert.Equal(t, ErrNoAuthentication, NewSocks5Server().ListenAndServe("127.0.0.1:0"))
+}
+
+func TestSocks5ServerAuthVersion(t *testing.T) {
+	m := log.NewMetrics(nil)
+	server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5Credentials("user", "secret"), WithSocks5Metrics(m))
+	assert.Nil(t, err)
+	defer server.Close()
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	conn.Write([]byte{5, 1, 2})
+	reply := make([]byte, 2)
+	io.ReadFull(conn, reply)
+	assert.Equal(t, []byte{5, 2}, reply)
+	// valid credentials with the subnegotiation version 5 instead of 1
+	conn.Write(append(append([]byte{5, 4}, "user"...), append([]byte{6}, "secret"...)...))
+	io.ReadFull(conn, reply)
+	assert.Equal(t, []byte{1, 1}, reply)
+	assert.Equal(t, int64(1), m.Registry().Get("socks5_server.auth_failures").(metrics.Counter).Count())
+}
+
+func TestSocks5ServerAllowList(t *testing.T) {
+	target := newTestTarget(t, http.StatusOK, "ok")
+	u, _ := url.Parse(target)
+	_, port, _ := net.SplitHostPort(u.Host)
+	m := log.NewMetrics(nil)
+
+	for _, tc := range []struct {
+		allowList []string
+		host      string
+		allowed   bool
+	}{
+		{[]string{"127.0.0.1"}, "127.0.0.1", true},
+		{[]string{"127.0.0.0/8"}, "localhost", true},
+		{[]string{"localhost"}, "LOCALHOST", true},
+		{[]string{"*.example.com"}, "localhost", false},
+		{[]string{"10.0.0.0/8"}, "127.0.0.1", false},
+	} {
+		server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5NoAuth(), WithSocks5AllowList(tc.allowList...),
+			WithSocks5Metrics(m))
+		assert.Nil(t, err)
+		_, err = CheckProxyContext(context.Background(), addr, "http://"+net.JoinHostPort(tc.host, port))
+		if tc.allowed {
+			assert.Nil(t, err, tc.allowList)
+		} else {
+			var checkErr *ProxyCheckError
+			if assert.True(t, errors.As(err, &checkErr), tc.allowList) {
+				assert.Equal(t, StageHandshake, checkErr.Stage)
+			}
+		}
+		server.Close()
+	}
+	assert.Equal(t, int64(2), m.Registry().Get("socks5_server.denied").(metrics.Counter).Count())
+
+	s := NewSocks5Server(WithSocks5AllowList("*.example.com"))
+	_, err := s.allowedAddr(context.Background(), "api.example.com")
+	assert.Nil(t, err)
+	_, err = s.allowedAddr(context.Background(), "example.com.evil")
+	assert.NotNil(t, err)
+}
+
+func TestSocks5ServerRejectsUnsupportedCommands(t *testing.T) {
+	server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5NoAuth(), WithSocks5Metrics(log.NewMetrics(nil)))
+	assert.Nil(t, err)
+	defer server.Close()
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	conn.Write([]byte{5, 1, 0})
+	reply := make([]byte, 2)
+	io.ReadFull(conn, reply)
+	assert.Equal(t, []byte{5, 0}, reply)
+	// UDP ASSOCIATE
+	conn.Write([]byte{5, 3, 0, 1, 127, 0, 0, 1, 0, 53})
+	reply = make([]byte, 10)
+	io.ReadFull(conn, reply)
+	assert.Equal(t, byte(socks5CmdUnsupported), reply[1])
+}
+
+func TestSocks5ServerClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			// keep the tunnel open until the proxy closes it
+			io.Copy(io.Discard, conn)
+			conn.Close()
+		}
+	}()
+
+	m := log.NewMetrics(nil)
+	server, addr, err := StartSocks5Server("127.0.0.1:0", WithSocks5NoAuth(), WithSocks5Metrics(m))
+	assert.Nil(t, err)
+	d, _ := NewProxyDialer(addr)
+	conn, err := d.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		active, ok := m.Registry().Get("socks5_server.active").(metrics.Counter)
+		return ok && active.Count() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		server.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not close the open tunnel")
+	}
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrServerClosed, server.Serve(listener))
+}
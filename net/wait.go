@@ -0,0 +1,133 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emetriq/gohelper/retry"
+)
+
+// WaitOption configures WaitForProxyContext
+type WaitOption func(*waitConfig)
+
+type waitConfig struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxElapsed     time.Duration
+	maxAttempts    int
+	jitter         float64
+	attemptTimeout time.Duration
+	checkOpts      []ProxyCheckOption
+}
+
+// WithBackoff sets the wait after the first failed check and the max wait, the wait doubles after every
+// failed check (default 500ms up to 30s)
+func WithBackoff(initial, max time.Duration) WaitOption {
+	return func(cfg *waitConfig) {
+		if initial >= 0 && max >= initial {
+			cfg.initialBackoff = initial
+			cfg.maxBackoff = max
+		}
+	}
+}
+
+// WithMaxElapsedTime gives up when the next check would start after d since the first check (default 0, only the
+// context limits the wait)
+func WithMaxElapsedTime(d time.Duration) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.maxElapsed = d
+	}
+}
+
+// WithMaxAttempts gives up after n failed checks (default 0, no limit)
+func WithMaxAttempts(n int) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.maxAttempts = n
+	}
+}
+
+// WithJitter randomizes every wait by up to +/- the factor, e.g. 0.2 waits between 80% and 120% of the backoff
+// (default 0.2)
+func WithJitter(factor float64) WaitOption {
+	return func(cfg *waitConfig) {
+		if factor >= 0 && factor <= 1 {
+			cfg.jitter = factor
+		}
+	}
+}
+
+// WithAttemptTimeout limits a single check, 0 disables the limit (default 10s)
+func WithAttemptTimeout(d time.Duration) WaitOption {
+	return func(cfg *waitConfig) {
+		if d >= 0 {
+			cfg.attemptTimeout = d
+		}
+	}
+}
+
+// WithWaitCheckOptions validates the responses of the checks, see CheckProxyContext
+func WithWaitCheckOptions(opts ...ProxyCheckOption) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.checkOpts = append(cfg.checkOpts, opts...)
+	}
+}
+
+// ProxyWaitError is returned by WaitForProxyContext with the causes of all failed checks
+type ProxyWaitError struct {
+	// Attempts are the errors of the checks in order, mostly *ProxyCheckError
+	Attempts []error
+	// Elapsed is the duration from the first check until the wait gave up
+	Elapsed time.Duration
+	// Err is the error of the context if it ended the wait
+	Err error
+}
+
+func (e *ProxyWaitError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "proxy not ready after %d attempts in %s", len(e.Attempts), e.Elapsed.Round(time.Millisecond))
+	if e.Err != nil {
+		fmt.Fprintf(&sb, " (%v)", e.Err)
+	}
+	for idx, err := range e.Attempts {
+		fmt.Fprintf(&sb, "\n  attempt %d: %v", idx+1, err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the last check
+func (e *ProxyWaitError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return e.Err
+	}
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// WaitForProxyContext checks the proxy with CheckProxyContext until a check succeeds and returns its result
+// immediately. Between the checks it waits with exponential backoff and jitter. It gives up when ctx is done, the
+// max elapsed time would be exceeded or the max attempts are reached and returns a *ProxyWaitError.
+func WaitForProxyContext(ctx context.Context, proxyURL string, testURL string, opts ...WaitOption) (ProxyCheckResult, error) {
+	cfg := waitConfig{
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     30 * time.Second,
+		jitter:         0.2,
+		attemptTimeout: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	result, err := retry.DoValue(ctx, func(ctx context.Context) (ProxyCheckResult, error) {
+		return CheckProxyContext(ctx, proxyURL, testURL, cfg.checkOpts...)
+	},
+		retry.WithBackoff(retry.Exponential(cfg.initialBackoff, cfg.maxBackoff, cfg.jitter)),
+		retry.WithMaxAttempts(cfg.maxAttempts),
+		retry.WithMaxElapsedTime(cfg.maxElapsed),
+		retry.WithAttemptTimeout(cfg.attemptTimeout))
+	var retryErr *retry.Error
+	if errors.As(err, &retryErr) {
+		return ProxyCheckResult{}, &ProxyWaitError{Attempts: retryErr.Errors, Elapsed: retryErr.Elapsed, Err: retryErr.Err}
+	}
+	return result, err
+}
@@ -0,0 +1,86 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForProxyContextReturnsOnSuccess(t *testing.T) {
+	proxyAddr := startTestSocks5(t, "", "")
+	start := time.Now()
+	result, err := WaitForProxyContext(context.Background(), proxyAddr, newTestTarget(t, http.StatusOK, "ok"),
+		WithBackoff(time.Minute, time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, StageValidation, result.Stage)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	start = time.Now()
+	assert.Nil(t, WaitForSocks5Proxy(proxyAddr, newTestTarget(t, http.StatusOK, "ok"), 60, 3))
+	assert.Less(t, time.Since(start), 5*time.Second, "no wait after a successful check")
+}
+
+func TestWaitForProxyContextWaitsForProxy(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	proxyAddr := listener.Addr().String()
+	listener.Close()
+	target := newTestTarget(t, http.StatusOK, "ok")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listener, err := net.Listen("tcp", proxyAddr)
+		if err != nil {
+			return
+		}
+		server := NewSocks5Server(WithSocks5NoAuth(), WithSocks5Metrics(log.NewMetrics(nil)))
+		t.Cleanup(func() { server.Close() })
+		server.Serve(listener)
+	}()
+	_, err = WaitForProxyContext(context.Background(), proxyAddr, target, WithBackoff(10*time.Millisecond, 20*time.Millisecond),
+		WithMaxElapsedTime(5*time.Second))
+	assert.Nil(t, err)
+}
+
+func TestWaitForProxyContextFailure(t *testing.T) {
+	proxyAddr := deadProxyAddr(t)
+	target := newTestTarget(t, http.StatusOK, "ok")
+
+	_, err := WaitForProxyContext(context.Background(), proxyAddr, target, WithBackoff(time.Millisecond, 2*time.Millisecond),
+		WithMaxAttempts(3))
+	var waitErr *ProxyWaitError
+	if assert.True(t, errors.As(err, &waitErr)) {
+		assert.Len(t, waitErr.Attempts, 3)
+		assert.Nil(t, waitErr.Err)
+		assert.Contains(t, err.Error(), "attempt 3: proxy check failed in dial stage")
+	}
+	var checkErr *ProxyCheckError
+	if assert.True(t, errors.As(err, &checkErr)) {
+		assert.Equal(t, StageDial, checkErr.Stage)
+	}
+
+	start := time.Now()
+	_, err = WaitForProxyContext(context.Background(), proxyAddr, target, WithBackoff(40*time.Millisecond, time.Second),
+		WithJitter(0), WithMaxElapsedTime(100*time.Millisecond))
+	assert.Less(t, time.Since(start), time.Second)
+	if assert.True(t, errors.As(err, &waitErr)) {
+		// checks after 0, 40 and 120ms would exceed the max elapsed time
+		assert.Len(t, waitErr.Attempts, 2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = WaitForProxyContext(ctx, proxyAddr, target, WithBackoff(time.Hour, time.Hour))
+	if assert.True(t, errors.As(err, &waitErr)) {
+		assert.Equal(t, context.DeadlineExceeded, waitErr.Err)
+		assert.Len(t, waitErr.Attempts, 1)
+	}
+
+	assert.NotNil(t, WaitForSocks5Proxy(proxyAddr, target, 0, 2))
+}
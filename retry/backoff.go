@@ -0,0 +1,73 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes the wait before a retry
+type Backoff interface {
+	// Delay returns the wait before the retry with the given number (1 for the first retry),
+	// previous is the wait before the last retry or 0 before the first retry
+	Delay(retry int, previous time.Duration) time.Duration
+}
+
+// BackoffFunc adapts a func to a Backoff
+type BackoffFunc func(retry int, previous time.Duration) time.Duration
+
+// Delay calls f
+func (f BackoffFunc) Delay(retry int, previous time.Duration) time.Duration {
+	return f(retry, previous)
+}
+
+// Constant waits d before every retry
+func Constant(d time.Duration) Backoff {
+	return BackoffFunc(func(int, time.Duration) time.Duration {
+		return d
+	})
+}
+
+// Exponential waits initial before the first retry and doubles the wait up to max with every retry.
+// Every wait is randomized by up to +/- the jitter factor, e.g. 0.2 waits between 80% and 120%.
+func Exponential(initial, max time.Duration, jitter float64) Backoff {
+	return BackoffFunc(func(retry int, _ time.Duration) time.Duration {
+		d := initial
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return withJitter(d, jitter)
+	})
+}
+
+// DecorrelatedJitter waits a random duration between base and three times the previous wait, capped at max.
+// It spreads the retries of many clients better than Exponential, see
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func DecorrelatedJitter(base, max time.Duration) Backoff {
+	return BackoffFunc(func(_ int, previous time.Duration) time.Duration {
+		if previous < base {
+			previous = base
+		}
+		upper := previous * 3
+		if upper > max {
+			upper = max
+		}
+		if upper <= base {
+			return upper
+		}
+		return base + time.Duration(rand.Int63n(int64(upper-base)+1))
+	})
+}
+
+// withJitter randomizes d by up to +/- factor
+func withJitter(d time.Duration, factor float64) time.Duration {
+	if factor <= 0 {
+		return d
+	}
+	if factor > 1 {
+		factor = 1
+	}
+	return time.Duration(float64(d) * (1 + factor*(2*rand.Float64()-1)))
+}
@@ -0,0 +1,49 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstant(t *testing.T) {
+	b := Constant(time.Second)
+	assert.Equal(t, time.Second, b.Delay(1, 0))
+	assert.Equal(t, time.Second, b.Delay(5, time.Second))
+}
+
+func TestExponential(t *testing.T) {
+	b := Exponential(100*time.Millisecond, time.Second, 0)
+	delays := []time.Duration{}
+	var previous time.Duration
+	for retry := 1; retry <= 6; retry++ {
+		previous = b.Delay(retry, previous)
+		delays = append(delays, previous)
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+		800 * time.Millisecond, time.Second, time.Second}, delays)
+	assert.Equal(t, time.Second, b.Delay(1000, 0), "no overflow for many retries")
+
+	jittered := Exponential(time.Second, time.Second, 0.2)
+	for i := 0; i < 100; i++ {
+		d := jittered.Delay(1, 0)
+		assert.GreaterOrEqual(t, d, 800*time.Millisecond)
+		assert.LessOrEqual(t, d, 1200*time.Millisecond)
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	b := DecorrelatedJitter(100*time.Millisecond, time.Second)
+	var previous time.Duration
+	for retry := 1; retry <= 100; retry++ {
+		d := b.Delay(retry, previous)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+		if previous >= 100*time.Millisecond {
+			assert.LessOrEqual(t, d, 3*previous)
+		}
+		previous = d
+	}
+	assert.Equal(t, time.Second, DecorrelatedJitter(2*time.Second, time.Second).Delay(1, 0))
+}
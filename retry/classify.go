@@ -0,0 +1,125 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Classifier reports whether an error is worth a retry
+type Classifier func(err error) bool
+
+// AnyOf retries an error if one of the classifiers retries it
+func AnyOf(classifiers ...Classifier) Classifier {
+	return func(err error) bool {
+		for _, classifier := range classifiers {
+			if classifier(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// permanentError marks an error which is never retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err so it is never retried, Do returns the unwrapped err
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// StatusError is an http response with an error status code
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http request failed with status %s", e.Status)
+}
+
+// ResponseError returns a *StatusError if the response has a status code of 400 or higher, otherwise nil
+func ResponseError(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// retryableStatus reports whether an http status code is worth a retry, i.e. 429 and all 5xx except 501
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError && code != http.StatusNotImplemented
+}
+
+// HTTPStatus retries a *StatusError with the status 429 or a 5xx status except 501
+func HTTPStatus(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && retryableStatus(statusErr.StatusCode)
+}
+
+// NetworkError retries network errors like refused connections, resets and timeouts
+func NetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// AWSThrottle retries the throttling errors of the AWS SDK like ThrottlingException, RequestLimitExceeded
+// of EC2 or SlowDown of S3 and request failures with the status 429, 502, 503 or 504
+func AWSThrottle(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	if request.IsErrorThrottle(aerr) || aerr.Code() == "SlowDown" {
+		return true
+	}
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) {
+		switch failure.StatusCode() {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
+
+// AWSRetryable retries the throttling errors of AWSThrottle and the errors the AWS SDK considers retryable
+// like timeouts, connection errors and 5xx responses except 501
+func AWSRetryable(err error) bool {
+	if AWSThrottle(err) {
+		return true
+	}
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) {
+		return retryableStatus(failure.StatusCode())
+	}
+	return request.IsErrorRetryable(aerr)
+}
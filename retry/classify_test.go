@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("bad request")
+	err := fmt.Errorf("get: %w", Permanent(cause))
+	assert.True(t, IsPermanent(err))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, IsPermanent(cause))
+	assert.Nil(t, Permanent(nil))
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for code, retryable := range map[int]bool{200: false, 400: false, 404: false, 429: true, 500: true, 501: false, 503: true} {
+		resp := &http.Response{StatusCode: code, Status: http.StatusText(code)}
+		err := ResponseError(resp)
+		if code < 400 {
+			assert.Nil(t, err)
+			continue
+		}
+		assert.Equal(t, retryable, HTTPStatus(fmt.Errorf("wrapped: %w", err)), code)
+	}
+	assert.False(t, HTTPStatus(errors.New("other")))
+}
+
+func TestNetworkError(t *testing.T) {
+	_, err := net.Dial("tcp", "127.0.0.1:1")
+	assert.True(t, NetworkError(err))
+	assert.False(t, NetworkError(errors.New("other")))
+}
+
+func TestAWSClassifiers(t *testing.T) {
+	throttled := awserr.New("ThrottlingException", "rate exceeded", nil)
+	assert.True(t, AWSThrottle(throttled))
+	assert.True(t, AWSThrottle(fmt.Errorf("wrapped: %w", awserr.New("RequestLimitExceeded", "ec2 throttled", nil))))
+	assert.True(t, AWSThrottle(awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "id")))
+	assert.True(t, AWSThrottle(awserr.NewRequestFailure(awserr.New("Unknown", "too many", nil), 429, "id")))
+	assert.False(t, AWSThrottle(awserr.New("AccessDenied", "denied", nil)))
+	assert.False(t, AWSThrottle(errors.New("other")))
+
+	assert.True(t, AWSRetryable(throttled))
+	assert.True(t, AWSRetryable(awserr.NewRequestFailure(awserr.New("InternalError", "internal", nil), 500, "id")))
+	assert.True(t, AWSRetryable(awserr.New("RequestError", "send request failed", &net.OpError{Op: "dial", Err: errors.New("refused")})))
+	assert.False(t, AWSRetryable(awserr.NewRequestFailure(awserr.New("NoSuchKey", "not found", nil), 404, "id")))
+	assert.False(t, AWSRetryable(awserr.NewRequestFailure(awserr.New("NotImplemented", "not implemented", nil), 501, "id")))
+	assert.False(t, AWSRetryable(errors.New("other")))
+
+	classifier := AnyOf(AWSThrottle, HTTPStatus)
+	assert.True(t, classifier(throttled))
+	assert.True(t, classifier(&StatusError{StatusCode: 502}))
+	assert.False(t, classifier(errors.New("other")))
+}
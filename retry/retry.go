@@ -0,0 +1,228 @@
+// Package retry calls operations again when they fail with a retryable error.
+//
+//	err := retry.Do(ctx, func(ctx context.Context) error {
+//		_, err := s3Client.GetObjectWithContext(ctx, input)
+//		return err
+//	}, retry.WithClassifier(retry.AWSRetryable), retry.WithOnAttempt(retry.LogAttempt("s3 get")))
+package retry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+)
+
+// Attempt describes a failed call and is passed to the attempt hooks
+type Attempt struct {
+	// Number of the call starting with 1
+	Number int
+	Err    error
+	// Retrying is false if the error is not retried or the retries are exhausted
+	Retrying bool
+	// Delay is the wait before the next call if Retrying is true
+	Delay time.Duration
+	// Elapsed is the duration since the first call
+	Elapsed time.Duration
+}
+
+// Option configures Do
+type Option func(*config)
+
+type config struct {
+	maxAttempts    int
+	maxElapsed     time.Duration
+	attemptTimeout time.Duration
+	backoff        Backoff
+	classifier     Classifier
+	hooks          []func(Attempt)
+}
+
+// WithMaxAttempts limits the number of calls including the first one, 0 means no limit (default 3)
+func WithMaxAttempts(n int) Option {
+	return func(cfg *config) {
+		if n >= 0 {
+			cfg.maxAttempts = n
+		}
+	}
+}
+
+// WithMaxElapsedTime gives up when the next call would start after d since the first call
+// (default 0, no limit besides the context)
+func WithMaxElapsedTime(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxElapsed = d
+	}
+}
+
+// WithAttemptTimeout limits every call with a deadline on its context (default 0, no limit)
+func WithAttemptTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.attemptTimeout = d
+	}
+}
+
+// WithBackoff sets the wait between the calls (default Exponential(100ms, 10s, 0.2))
+func WithBackoff(b Backoff) Option {
+	return func(cfg *config) {
+		if b != nil {
+			cfg.backoff = b
+		}
+	}
+}
+
+// WithClassifier retries only the errors the classifier accepts (default all errors).
+// Errors marked with Permanent and errors of a done context are never retried.
+func WithClassifier(c Classifier) Option {
+	return func(cfg *config) {
+		cfg.classifier = c
+	}
+}
+
+// WithOnAttempt adds a hook which is called after every failed call, e.g. for logging or metrics
+func WithOnAttempt(hook func(Attempt)) Option {
+	return func(cfg *config) {
+		cfg.hooks = append(cfg.hooks, hook)
+	}
+}
+
+// LogAttempt returns a hook which logs failed calls of the operation as warnings through log.Logger
+func LogAttempt(operation string) func(Attempt) {
+	return func(a Attempt) {
+		if a.Retrying {
+			log.Logger.Warnf("%s failed in attempt %d, retrying in %s: %v", operation, a.Number, a.Delay, a.Err)
+		} else {
+			log.Logger.Warnf("%s failed in attempt %d, giving up: %v", operation, a.Number, a.Err)
+		}
+	}
+}
+
+// CountAttempts returns a hook which counts the retries in retry.retries and the failures after the last attempt in
+// retry.failures, both tagged with operation=<operation>. If m is nil log.DefaultMetrics is used.
+func CountAttempts(m *log.Metrics, operation string) func(Attempt) {
+	if m == nil {
+		m = log.DefaultMetrics
+	}
+	tags := map[string]string{"operation": operation}
+	retries := m.GetTaggedCounter("retry.retries", tags)
+	failures := m.GetTaggedCounter("retry.failures", tags)
+	return func(a Attempt) {
+		if a.Retrying {
+			retries.Inc(1)
+		} else {
+			failures.Inc(1)
+		}
+	}
+}
+
+// Error is returned by Do if the retries are exhausted or the context ended the retries
+type Error struct {
+	// Errors of all calls in order
+	Errors []error
+	// Elapsed is the duration from the first call until Do gave up
+	Elapsed time.Duration
+	// Err is the error of the context if it ended the retries
+	Err error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "failed after %d attempts in %s", len(e.Errors), e.Elapsed.Round(time.Millisecond))
+	if e.Err != nil {
+		fmt.Fprintf(&sb, " (%v)", e.Err)
+	}
+	for idx, err := range e.Errors {
+		fmt.Fprintf(&sb, "\n  attempt %d: %v", idx+1, err)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the error of the last call
+func (e *Error) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return e.Err
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+// Do calls fn until it succeeds. It returns nil on success, the error of fn if it is not retryable (unwrapped if
+// it is marked with Permanent) and an *Error if the retries are exhausted or ctx is done.
+func Do(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) error {
+	_, err := DoValue(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, opts...)
+	return err
+}
+
+// DoValue calls fn until it succeeds and returns its value, see Do
+func DoValue[T any](ctx context.Context, fn func(ctx context.Context) (T, error), opts ...Option) (T, error) {
+	cfg := config{
+		maxAttempts: 3,
+		backoff:     Exponential(100*time.Millisecond, 10*time.Second, 0.2),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	start := time.Now()
+	retryErr := &Error{}
+	var zero T
+	var delay time.Duration
+	for number := 1; ; number++ {
+		value, err := call(ctx, cfg.attemptTimeout, fn)
+		if err == nil {
+			return value, nil
+		}
+		retryErr.Errors = append(retryErr.Errors, err)
+		attempt := Attempt{Number: number, Err: err, Elapsed: time.Since(start)}
+
+		if ctx.Err() != nil {
+			cfg.notify(attempt)
+			retryErr.Elapsed, retryErr.Err = time.Since(start), ctx.Err()
+			return zero, retryErr
+		}
+		if permanent, ok := err.(*permanentError); ok {
+			cfg.notify(attempt)
+			return zero, permanent.err
+		}
+		if IsPermanent(err) || cfg.classifier != nil && !cfg.classifier(err) {
+			cfg.notify(attempt)
+			return zero, err
+		}
+		delay = cfg.backoff.Delay(number, delay)
+		if cfg.maxAttempts > 0 && number >= cfg.maxAttempts ||
+			cfg.maxElapsed > 0 && attempt.Elapsed+delay > cfg.maxElapsed {
+			cfg.notify(attempt)
+			retryErr.Elapsed = time.Since(start)
+			return zero, retryErr
+		}
+
+		attempt.Retrying, attempt.Delay = true, delay
+		cfg.notify(attempt)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			retryErr.Elapsed, retryErr.Err = time.Since(start), ctx.Err()
+			return zero, retryErr
+		case <-timer.C:
+		}
+	}
+}
+
+// call calls fn with a context limited by the attempt timeout
+func call[T any](ctx context.Context, timeout time.Duration, fn func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+func (cfg *config) notify(attempt Attempt) {
+	for _, hook := range cfg.hooks {
+		hook(attempt)
+	}
+}
@@ -0,0 +1,110 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emetriq/gohelper/log"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTemporary = errors.New("temporary")
+
+// failTimes returns a func which fails n times with err and then succeeds
+func failTimes(n int, err error) (func(ctx context.Context) (int, error), *int) {
+	calls := 0
+	return func(ctx context.Context) (int, error) {
+		calls++
+		if calls <= n {
+			return 0, err
+		}
+		return calls, nil
+	}, &calls
+}
+
+func TestDoValueRetriesUntilSuccess(t *testing.T) {
+	fn, calls := failTimes(2, errTemporary)
+	attempts := []Attempt{}
+	value, err := DoValue(context.Background(), fn, WithBackoff(Constant(time.Millisecond)),
+		WithOnAttempt(func(a Attempt) { attempts = append(attempts, a) }))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, value)
+	assert.Equal(t, 3, *calls)
+	if assert.Len(t, attempts, 2) {
+		assert.Equal(t, 1, attempts[0].Number)
+		assert.True(t, attempts[0].Retrying)
+		assert.Equal(t, time.Millisecond, attempts[0].Delay)
+		assert.Equal(t, errTemporary, attempts[1].Err)
+	}
+}
+
+func TestDoExhaustsAttempts(t *testing.T) {
+	fn, calls := failTimes(10, errTemporary)
+	m := log.NewMetrics(nil)
+	err := Do(context.Background(), func(ctx context.Context) error {
+		_, err := fn(ctx)
+		return err
+	}, WithMaxAttempts(4), WithBackoff(Constant(time.Millisecond)), WithOnAttempt(CountAttempts(m, "test")))
+	var retryErr *Error
+	if assert.True(t, errors.As(err, &retryErr)) {
+		assert.Len(t, retryErr.Errors, 4)
+		assert.Nil(t, retryErr.Err)
+		assert.Contains(t, err.Error(), "failed after 4 attempts")
+		assert.Contains(t, err.Error(), "attempt 4: temporary")
+	}
+	assert.True(t, errors.Is(err, errTemporary))
+	assert.Equal(t, 4, *calls)
+	assert.Equal(t, int64(3), m.Registry().Get("retry.retries;operation=test").(metrics.Counter).Count())
+	assert.Equal(t, int64(1), m.Registry().Get("retry.failures;operation=test").(metrics.Counter).Count())
+}
+
+func TestDoStopsOnNonRetryableErrors(t *testing.T) {
+	cause := errors.New("bad request")
+	fn, calls := failTimes(10, Permanent(cause))
+	_, err := DoValue(context.Background(), fn, WithBackoff(Constant(time.Millisecond)))
+	assert.Equal(t, cause, err)
+	assert.Equal(t, 1, *calls)
+
+	fn, calls = failTimes(10, errTemporary)
+	_, err = DoValue(context.Background(), fn, WithClassifier(HTTPStatus))
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestDoMaxElapsedTimeAndContext(t *testing.T) {
+	fn, calls := failTimes(100, errTemporary)
+	start := time.Now()
+	_, err := DoValue(context.Background(), fn, WithMaxAttempts(0), WithBackoff(Constant(40*time.Millisecond)),
+		WithMaxElapsedTime(100*time.Millisecond))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NotNil(t, err)
+	// calls after 0, 40 and 80ms, the next one after 120ms would exceed the max elapsed time
+	assert.Equal(t, 3, *calls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	fn, calls = failTimes(100, errTemporary)
+	_, err = DoValue(ctx, fn, WithMaxAttempts(0), WithBackoff(Constant(time.Hour)))
+	var retryErr *Error
+	if assert.True(t, errors.As(err, &retryErr)) {
+		assert.Equal(t, context.DeadlineExceeded, retryErr.Err)
+	}
+	assert.Equal(t, 1, *calls)
+}
+
+func TestDoAttemptTimeout(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}, WithAttemptTimeout(10*time.Millisecond), WithBackoff(Constant(time.Millisecond)))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+}